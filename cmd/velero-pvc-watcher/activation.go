@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// first file descriptor passed by systemd, after stdin, stdout and stderr
+	ListenFDsStart = 3
+)
+
+// activatedSocket is a listening socket passed by systemd socket activation,
+// the name is the FileDescriptorName= of the socket unit
+type activatedSocket struct {
+	name     string
+	listener net.Listener
+}
+
+// activatedSockets returns the sockets passed via LISTEN_FDS if they are
+// meant for this process
+func activatedSockets() ([]activatedSocket, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %w", err)
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// do not pass the sockets on to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	sockets := []activatedSocket{}
+	for i := 0; i < count; i++ {
+		fd := ListenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to use socket %d (%s): %w", fd, name, err)
+		}
+		sockets = append(sockets, activatedSocket{name: name, listener: listener})
+	}
+	return sockets, nil
+}
+
+// groupAddrs returns the listen addresses of an endpoint group, the group
+// flag if set, else --listen-addr. The default of --listen-addr is dropped
+// if systemd passed sockets, the socket unit usually binds the same port
+// already.
+func groupAddrs(addrs string, sockets []activatedSocket) string {
+	switch {
+	case addrs != "":
+		return addrs
+	case flagGiven("listen-addr") || os.Getenv(ListenAddrEnv) != "":
+		return *listenAddr
+	case len(sockets) > 0:
+		return ""
+	}
+	return *listenAddr
+}
+
+// flagGiven checks if the flag was set on the command line or in the config
+// file
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
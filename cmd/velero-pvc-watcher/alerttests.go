@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"bitsbeats/velero-pvc-watcher/pkg/watcher"
+)
+
+const (
+	AlertTestsCommand = "alert-tests"
+
+	// DefaultAlertRuleFile is the rule file the tests load if none is given
+	DefaultAlertRuleFile = "velero-pvc-watcher.rules.yaml"
+)
+
+// runAlertTests prints promtool unit tests of the example alert rule for the
+// labels and metric names configured by the flags, the rule files are the
+// arguments
+func runAlertTests(configErrs []error, ruleFiles []string) int {
+	errs := append(configErrs, validateFlags()...)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "configuration is invalid, %d problem(s) found\n", len(errs))
+		return 1
+	}
+	config, err := buildConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(ruleFiles) == 0 {
+		ruleFiles = []string{DefaultAlertRuleFile}
+	}
+	tests, err := watcher.AlertTests(config, *metricNames, ruleFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to generate alert tests: %s\n", err)
+		return 1
+	}
+	os.Stdout.Write(tests)
+	return 0
+}
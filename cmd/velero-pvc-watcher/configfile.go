@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ConfigAPIVersion = "velero-pvc-watcher.bitsbeats.io/v1"
+	ConfigKind       = "Config"
+
+	redacted = "REDACTED"
+)
+
+type (
+	// configMigration converts a config from one apiVersion to the next
+	configMigration struct {
+		from    string
+		to      string
+		migrate func(map[string]interface{}) (map[string]interface{}, error)
+	}
+)
+
+var (
+	// secretFlags are redacted in the effective configuration
+	secretFlags = map[string]struct{}{
+		"debug-token":          {},
+		"remote-write-headers": {},
+	}
+
+	// configSources are the flags set from the config file
+	configSources = map[string]struct{}{}
+
+	// configMigrations are applied in order until the config has the
+	// current apiVersion, an empty from is a config without apiVersion
+	configMigrations = []configMigration{
+		{"", ConfigAPIVersion, migrateUnversionedConfig},
+	}
+)
+
+// loadConfigFile sets all flags that were not given on the command line from
+// a yaml or json file, older apiVersions are migrated. The keys of options
+// are flag names without dashes, lists set repeatable flags once per entry
+// and are comma separated otherwise, all invalid options are reported
+func loadConfigFile(path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("unable to read config: %w", err)}
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return []error{fmt.Errorf("unable to parse config: %w", err)}
+	}
+	raw, err = migrateConfig(raw)
+	if err != nil {
+		return []error{err}
+	}
+	if kind, _ := raw["kind"].(string); kind != ConfigKind {
+		return []error{fmt.Errorf("unexpected kind %q in config, expected %s", kind, ConfigKind)}
+	}
+	for key := range raw {
+		if key != "apiVersion" && key != "kind" && key != "options" {
+			return []error{fmt.Errorf("unknown field %q in config, flags belong into options", key)}
+		}
+	}
+	values, ok := raw["options"].(map[string]interface{})
+	if !ok && raw["options"] != nil {
+		return []error{fmt.Errorf("options in config have to be a map")}
+	}
+	given := map[string]struct{}{}
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = struct{}{}
+	})
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	errs := []error{}
+	for _, key := range keys {
+		f := flag.Lookup(key)
+		if f == nil || key == "config" {
+			errs = append(errs, fmt.Errorf("unknown option %q in config", key))
+			continue
+		}
+		if _, ok := given[key]; ok {
+			continue
+		}
+		if err := setFlag(f, values[key]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s in config: %w", key, err))
+			continue
+		}
+		configSources[key] = struct{}{}
+	}
+	return errs
+}
+
+// migrateConfig converts a config to the current apiVersion and warns about
+// deprecated versions
+func migrateConfig(raw map[string]interface{}) (map[string]interface{}, error) {
+	for {
+		version, _ := raw["apiVersion"].(string)
+		if version == ConfigAPIVersion {
+			return raw, nil
+		}
+		var migration *configMigration
+		for i := range configMigrations {
+			if configMigrations[i].from == version {
+				migration = &configMigrations[i]
+				break
+			}
+		}
+		if migration == nil {
+			return nil, fmt.Errorf("unsupported apiVersion %q in config, expected %s", version, ConfigAPIVersion)
+		}
+		if version == "" {
+			log.Printf("deprecated: config without apiVersion, migrating to %s", migration.to)
+		} else {
+			log.Printf("deprecated: config apiVersion %s, migrating to %s", version, migration.to)
+		}
+		migrated, err := migration.migrate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to migrate config to %s: %w", migration.to, err)
+		}
+		migrated["apiVersion"] = migration.to
+		raw = migrated
+	}
+}
+
+// migrateUnversionedConfig moves the flag names of a config without
+// apiVersion into options
+func migrateUnversionedConfig(raw map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := raw["kind"]; ok {
+		return nil, fmt.Errorf("kind requires an apiVersion")
+	}
+	return map[string]interface{}{
+		"kind":    ConfigKind,
+		"options": raw,
+	}, nil
+}
+
+func setFlag(f *flag.Flag, value interface{}) error {
+	list, ok := value.([]interface{})
+	if !ok {
+		return f.Value.Set(configString(value))
+	}
+	switch f.Value.(type) {
+	case *thresholdFlag, *ruleFlag:
+		for _, entry := range list {
+			if err := f.Value.Set(configString(entry)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	parts := []string{}
+	for _, entry := range list {
+		parts = append(parts, configString(entry))
+	}
+	return f.Value.Set(strings.Join(parts, ","))
+}
+
+// configString formats a yaml value like it would be given as flag
+func configString(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// effectiveConfig returns the value of every flag in the config file format,
+// secrets redacted, and where each value came from: flag, config or default
+func effectiveConfig() map[string]interface{} {
+	given := map[string]struct{}{}
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = struct{}{}
+	})
+	options := map[string]interface{}{}
+	sources := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		switch value := f.Value.(type) {
+		case *thresholdFlag:
+			entries := []string{}
+			for _, threshold := range *value {
+				entries = append(entries, threshold.String())
+			}
+			options[f.Name] = entries
+		case *ruleFlag:
+			entries := []string{}
+			for _, rule := range *value {
+				entries = append(entries, rule.String())
+			}
+			options[f.Name] = entries
+		default:
+			options[f.Name] = redactOption(f.Name, f.Value.String())
+		}
+		sources[f.Name] = "default"
+		if _, ok := configSources[f.Name]; ok {
+			sources[f.Name] = "config"
+		}
+		if _, ok := given[f.Name]; ok {
+			sources[f.Name] = "flag"
+		}
+	})
+	return map[string]interface{}{
+		"apiVersion": ConfigAPIVersion,
+		"kind":       ConfigKind,
+		"options":    options,
+		"sources":    sources,
+	}
+}
+
+// redactOption hides secret flags and passwords in urls
+func redactOption(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if _, ok := secretFlags[name]; ok {
+		return redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			return u.String()
+		}
+	}
+	return value
+}
+
+// effectiveConfigHandler serves the effective configuration as json
+func effectiveConfigHandler(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(rw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(effectiveConfig()); err != nil {
+		log.Printf("unable to write response: %s", err)
+	}
+}
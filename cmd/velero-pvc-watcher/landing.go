@@ -0,0 +1,47 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+)
+
+var (
+	landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{ .Name }}</title></head>
+<body>
+<h1>{{ .Name }}</h1>
+<p>version {{ .Version }}</p>
+<ul>
+{{- range .Paths }}
+<li><a href="{{ . }}">{{ . }}</a></li>
+{{- end }}
+</ul>
+</body>
+</html>
+`))
+)
+
+// landingPage links the endpoints served on an address at /, every other
+// unknown path is answered with 404
+func landingPage(paths []string) http.Handler {
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := landingTemplate.Execute(rw, struct {
+			Name    string
+			Version string
+			Paths   []string
+		}{AppName, Version, sorted})
+		if err != nil {
+			log.Printf("unable to render landing page: %s", err)
+		}
+	})
+}
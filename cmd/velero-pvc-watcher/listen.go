@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serverTimeouts are applied to every http server, zero disables a timeout
+type serverTimeouts struct {
+	readHeader time.Duration
+	read       time.Duration
+	write      time.Duration
+	idle       time.Duration
+}
+
+const (
+	EndpointsMetrics = "metrics"
+	EndpointsHealth  = "health"
+	EndpointsAPI     = "api"
+)
+
+var (
+	endpointGroups = map[string]struct{}{
+		EndpointsMetrics: {},
+		EndpointsHealth:  {},
+		EndpointsAPI:     {},
+	}
+)
+
+// endpointMux records the registered paths for the landing page
+type endpointMux struct {
+	*http.ServeMux
+	paths []string
+}
+
+func newEndpointMux() *endpointMux {
+	return &endpointMux{ServeMux: http.NewServeMux()}
+}
+
+func (m *endpointMux) Handle(pattern string, handler http.Handler) {
+	m.paths = append(m.paths, pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m *endpointMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// listeners maps the listen addresses to the mux serving the endpoint groups
+// configured for them, groups sharing an address share the server
+type listeners struct {
+	muxes   map[string]*endpointMux
+	sockets map[string]net.Listener
+	names   map[string]string
+}
+
+// newListeners creates listeners serving the sockets passed by systemd in
+// addition to the configured addresses
+func newListeners(sockets []activatedSocket) *listeners {
+	l := &listeners{
+		muxes:   map[string]*endpointMux{},
+		sockets: map[string]net.Listener{},
+		names:   map[string]string{},
+	}
+	for _, socket := range sockets {
+		key := fmt.Sprintf("systemd socket %s (%s)", socket.listener.Addr(), socket.name)
+		l.muxes[key] = newEndpointMux()
+		l.sockets[key] = socket.listener
+		l.names[key] = socket.name
+	}
+	return l
+}
+
+// handle registers the handlers of an endpoint group on each of the comma
+// separated addresses and on the activated sockets named after the group,
+// sockets not named after any group serve all groups
+func (l *listeners) handle(group, addrs string, register func(mux *endpointMux)) error {
+	for key, name := range l.names {
+		if _, ok := endpointGroups[name]; !ok || name == group {
+			register(l.muxes[key])
+		}
+	}
+	if addrs == "" && len(l.sockets) > 0 {
+		return nil
+	}
+	parsed, err := parseListenAddrs(addrs)
+	if err != nil {
+		return err
+	}
+	for _, addr := range parsed {
+		mux, ok := l.muxes[addr]
+		if !ok {
+			mux = newEndpointMux()
+			l.muxes[addr] = mux
+		}
+		register(mux)
+	}
+	return nil
+}
+
+// listen binds all addresses before serving any of them, so a taken port
+// fails the startup instead of a single endpoint group
+func (l *listeners) listen() ([]net.Listener, []*endpointMux, error) {
+	addrs := []string{}
+	for addr := range l.muxes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	bound := []net.Listener{}
+	muxes := []*endpointMux{}
+	for _, addr := range addrs {
+		if socket, ok := l.sockets[addr]; ok {
+			bound = append(bound, socket)
+			muxes = append(muxes, l.muxes[addr])
+			continue
+		}
+		// tcp listens dual-stack on unspecified hosts like [::] or an empty
+		// host and on the address family of an ip otherwise
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, b := range bound {
+				b.Close()
+			}
+			return nil, nil, fmt.Errorf("unable to listen on %s: %w", addr, err)
+		}
+		bound = append(bound, listener)
+		muxes = append(muxes, l.muxes[addr])
+	}
+	return bound, muxes, nil
+}
+
+// serve the endpoint groups on all bound addresses
+func (l *listeners) serve(timeouts serverTimeouts) error {
+	bound, muxes, err := l.listen()
+	if err != nil {
+		return err
+	}
+	for i, listener := range bound {
+		muxes[i].ServeMux.Handle("/", landingPage(muxes[i].paths))
+		server := &http.Server{
+			Handler:           muxes[i],
+			ReadHeaderTimeout: timeouts.readHeader,
+			ReadTimeout:       timeouts.read,
+			WriteTimeout:      timeouts.write,
+			IdleTimeout:       timeouts.idle,
+		}
+		go func(listener net.Listener) {
+			log.Printf("listening on %s", listener.Addr())
+			log.Fatal(server.Serve(listener))
+		}(listener)
+	}
+	return nil
+}
+
+// parseListenAddrs parses a comma separated list of host:port addresses,
+// ipv6 addresses have to be enclosed in brackets like [::1]:2121
+func parseListenAddrs(s string) ([]string, error) {
+	addrs := []string{}
+	seen := map[string]struct{}{}
+	for _, addr := range strings.Split(s, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q, expected host:port or [ipv6]:port: %w", addr, err)
+		}
+		if port == "" {
+			return nil, fmt.Errorf("missing port in listen address %q", addr)
+		}
+		addr = net.JoinHostPort(host, port)
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+		seen[addr] = struct{}{}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no listen address given")
+	}
+	return addrs, nil
+}
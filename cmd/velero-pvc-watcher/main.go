@@ -0,0 +1,663 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"bitsbeats/velero-pvc-watcher/pkg/watcher"
+)
+
+const (
+	ListenAddr = ":2121"
+	AppName    = "velero-pvc-watcher"
+
+	// ListenAddrEnv overrides the default of --listen-addr
+	ListenAddrEnv = "LISTEN_ADDR"
+
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+var (
+	// Version is set at build time with -ldflags "-X main.Version=..."
+	Version = "dev"
+
+	failOn thresholdFlag
+	rules  ruleFlag
+
+	configFile             = flag.String("config", "", "yaml or json file with flag names as keys, flags given on the command line take precedence")
+	excludeNamespacesRegex = flag.String("exclude-namespaces-regex", "", "exclude all namespaces matching the regular expression")
+	ownerKinds             = flag.String("owner-kinds", "", "comma separated top level owner kinds to evaluate, e.g. StatefulSet,Deployment (Pod for bare pods), all if empty")
+	requireMounted         = flag.Bool("require-mounted", false, "report backed up PVC volumes that are not mounted by any container as unmounted")
+	initOnlyExcluded       = flag.Bool("init-only-excluded", true, "treat PVC volumes without backup annotation that are only mounted by init containers as excluded, e.g. migration volumes")
+	namespaceLabels        = flag.String("namespace-labels", "", "comma separated namespace labels copied onto the exported series, e.g. team,cost-center")
+	pvcLabelLabels         = flag.String("pvc-label-labels", "", "comma separated PVC labels copied onto the per PVC series, e.g. app.kubernetes.io/name,app.kubernetes.io/instance")
+	excludeDataSources     = flag.Bool("exclude-data-sources", false, "treat missing PVCs provisioned from a VolumeSnapshot or cloned from a PVC as excluded unless annotated with velero-pvc-watcher/evaluate-data-source=true")
+	tenantMapping          = flag.String("tenant-mapping", "", "yaml file assigning namespaces to tenants and their velero storage locations, adds a tenant label and per tenant coverage")
+	storageClassPrices     = flag.String("storage-class-prices", "", "comma separated storage-class=price monthly prices per GiB to estimate the cost of unprotected data")
+	evaluationWorkers      = flag.Int("evaluation-workers", 4, "number of namespaces evaluated in parallel")
+	evaluationCache        = flag.Duration("evaluation-cache", 5*time.Second, "time a full evaluation is reused by following scrapes, e.g. of Prometheus replicas scraping at the same instant, disabled if 0")
+	evaluationJitter       = flag.Duration("evaluation-jitter", 0, "maximum random delay of periodic evaluations in --dry-run and of remote-write pushes")
+	lowMemory              = flag.Bool("low-memory", false, "cache only the pod fields needed for evaluation to reduce memory usage on large clusters")
+	inspectCronJobs        = flag.Bool("inspect-cronjobs", false, "evaluate the job template of cronjobs like a pod so PVCs only mounted by periodic jobs are evaluated between runs")
+	pvcProtected           = flag.String("pvc-protected", "", "comma separated key=value annotations or labels marking a PVC as protected")
+	pvcExcluded            = flag.String("pvc-excluded", "", "comma separated key=value annotations or labels marking a PVC as excluded")
+	featureGates           = flag.String("feature-gates", "", "comma separated Name=true|false pairs toggling features, e.g. CSIVerification=false")
+	opaPolicy              = flag.String("opa-policy", "", "comma separated Rego policy files or directories evaluated in-process to decide the state of PVCs")
+	opaQuery               = flag.String("opa-query", watcher.OPAQuery, "query of the --opa-policy decisions, an object mapping PVC names to states")
+	onboardingWindow       = flag.Duration("onboarding-window", 0, "flag namespaces younger than the window that have PVCs but no backup, disabled if 0, e.g. 720h")
+	onboardingGrace        = flag.Duration("onboarding-grace", 24*time.Hour, "time new namespaces get to set up backups before they are flagged")
+	snapshotProvisioners   = flag.String("snapshot-provisioners", "", "comma separated provisioners the installed velero plugins can snapshot, missing PVCs of other provisioners get reason no-snapshot-support, requires --velero-crds")
+	staleBackupAge         = flag.Duration("stale-backup-age", 0, "report protected PVCs of namespaces without a completed velero backup within the age as at risk with reason stale_backup, disabled if 0, e.g. 48h, requires --velero-crds")
+	virtualNodes           = flag.Bool("virtual-nodes", false, "report PVCs of pods on virtual-kubelet or Fargate nodes relying on fs-backup as missing, the node-agent can not run there")
+	virtualNodesCSI        = flag.Bool("virtual-nodes-csi", false, "treat PVCs of pods on virtual nodes as protected if their storage class supports csi snapshots, requires --virtual-nodes and --velero-crds")
+	readOnly               = flag.Bool("read-only", false, "refuse to start if write permissions are held or features writing to the cluster are enabled, e.g. for restricted environments")
+	excludePodsSelector    = flag.String("exclude-pods-selector", "velero-pvc-watcher/ignore=true", "label selector for pods whose PVCs are treated as excluded")
+
+	veleroCRDs       = flag.Bool("velero-crds", false, "watch velero custom resources like backups")
+	veleroNamespace  = flag.String("velero-namespace", "velero", "namespace velero is installed in")
+	adHocBackups     = flag.Bool("ad-hoc-backups", false, "create a velero backup of a namespace as soon as a missing PVC in it becomes protected")
+	adHocBackupTTL   = flag.Duration("ad-hoc-backup-ttl", 720*time.Hour, "ttl of the ad-hoc velero backups")
+	autoSchedules    = flag.String("auto-schedules", "", "create velero schedules for namespaces with PVCs not covered by any schedule: dry-run or create, disabled if empty")
+	autoScheduleCron = flag.String("auto-schedule-cron", "0 2 * * *", "cron expression of the created schedules")
+	autoScheduleTTL  = flag.Duration("auto-schedule-ttl", 720*time.Hour, "ttl of the backups of the created schedules")
+	metricNames      = flag.String("metric-names", watcher.MetricNamesLegacy, "metric names to export: legacy (backupmonitor_*), new (velero_pvc_watcher_*) or both")
+	dryRun           = flag.Bool("dry-run", false, "log the changes of the metrics every minute instead of serving /metrics")
+	once             = flag.Bool("once", false, "evaluate once, print the result and exit")
+	kubeconfig       = flag.String("kubeconfig", "", "kubeconfig file used out of cluster, KUBECONFIG (colon separated files are merged) or ~/.kube/config if empty")
+	kubeContext      = flag.String("context", "", "kubeconfig context used out of cluster, the current context if empty")
+	impersonateUser  = flag.String("as", "", "user to impersonate in --once mode, e.g. system:serviceaccount:<namespace>:<name>")
+	impersonateGroup = flag.String("as-group", "", "comma separated groups to impersonate in --once mode, requires --as")
+	output           = flag.String("output", watcher.FormatTable, "output format of --once: json, yaml, table, sarif, csv, markdown or html")
+	color            = flag.String("color", ColorAuto, "color the table of --once: auto (if stdout is a terminal and NO_COLOR is unset), always or never")
+	remediationDir   = flag.String("remediation-dir", "", "write kustomize patches adding the missing backup annotations into the directory in --once mode")
+	exportPolicy     = flag.String("export-policy", "", "print the admission policy equivalent to the configuration and exit: gatekeeper or kyverno")
+	hookCommand      = flag.String("hook-command", "", "command with space separated arguments run when a PVC becomes unprotected or protected, the event is passed as VELERO_PVC_WATCHER_* environment variables")
+	reportWebhook    = flag.String("report-webhook", "", "post a json coverage report to the url at the end of every --report-period")
+	reportPeriod     = flag.String("report-period", watcher.ReportWeekly, "period of the coverage reports: weekly (mondays) or monthly")
+
+	reportS3Bucket      = flag.String("report-s3-bucket", "", "upload the coverage report of every --report-period to the S3 bucket")
+	reportS3Prefix      = flag.String("report-s3-prefix", "", "prefix of the uploaded reports in --report-s3-bucket")
+	reportS3Region      = flag.String("report-s3-region", watcher.S3DefaultRegion, "region of --report-s3-bucket")
+	reportS3URL         = flag.String("report-s3-url", "", "endpoint of S3-compatible storage like MinIO, objects are addressed path-style if set")
+	reportS3Credentials = flag.String("report-s3-credentials-file", "", "AWS shared credentials file like the velero credentials secret, the AWS_* environment variables are used if empty")
+	reportS3Profile     = flag.String("report-s3-profile", "default", "profile of --report-s3-credentials-file")
+	reportS3Format      = flag.String("report-s3-format", watcher.FormatJSON, "format of the uploaded reports: json, csv, markdown or html")
+
+	remoteWriteURL      = flag.String("remote-write-url", "", "push the metrics to the Prometheus remote-write endpoint every --remote-write-interval, e.g. https://mimir.example.com/api/v1/push")
+	remoteWriteInterval = flag.Duration("remote-write-interval", time.Minute, "interval the metrics are pushed to --remote-write-url")
+	remoteWriteHeaders  = flag.String("remote-write-headers", "", "comma separated Name=value headers of the remote-write requests, e.g. X-Scope-OrgID=edge-1")
+	remoteWriteLabels   = flag.String("remote-write-labels", "job="+AppName, "comma separated name=value labels added to the pushed series, instance defaults to the hostname")
+
+	historyFile      = flag.String("history-file", "", "persist the evaluation history as json lines into the file, e.g. on a small PVC, kept in memory only if empty")
+	historyRetention = flag.Duration("history-retention", 720*time.Hour, "age of the history entries kept in --history-file, older entries are compacted into daily rollups")
+	historyRollups   = flag.Duration("history-rollup-retention", 8760*time.Hour, "age of the daily rollups kept in --history-file, 0 drops entries older than --history-retention")
+	summaryConfigMap = flag.String("summary-configmap", "", "publish the coverage summary as json into the configmap namespace/name")
+	debugToken       = flag.String("debug-token", "", "bearer token protecting /debug/state, the endpoint is disabled if empty")
+	userAgent        = flag.String("user-agent", "", "user agent of the kubernetes client to identify the watcher in audit logs and flow schemas, velero-pvc-watcher/<version> if empty")
+	syslogAddr       = flag.String("syslog-addr", "", "forward logs to syslog, e.g. udp://host:514, tcp://host:514 or tls://host:6514")
+	listenAddr       = flag.String("listen-addr", envOrDefault(ListenAddrEnv, ListenAddr), "comma separated listen addresses of the endpoint groups not given with --metrics-addrs, --health-addrs or --api-addrs, defaults to $LISTEN_ADDR if set")
+	metricsAddrs     = flag.String("metrics-addrs", "", "comma separated listen addresses of /metrics, e.g. [::]:2121,127.0.0.1:2122, --listen-addr if empty")
+	healthAddrs      = flag.String("health-addrs", "", "comma separated listen addresses of /ready and /selftest, --listen-addr if empty")
+	apiAddrs         = flag.String("api-addrs", "", "comma separated listen addresses of /api/v1 and /debug/state, --listen-addr if empty")
+
+	metricsPath           = flag.String("metrics-path", "/metrics", "path the metrics are served at")
+	metricsCompression    = flag.Bool("metrics-compression", true, "gzip /metrics responses if the scraper accepts it")
+	metricsMaxRequests    = flag.Int("metrics-max-requests-in-flight", 4, "concurrent /metrics requests, additional requests are answered with 503, 0 disables the limit")
+	metricsTimeout        = flag.Duration("metrics-timeout", 30*time.Second, "time to gather the metrics before answering /metrics with 503, 0 disables the timeout")
+	httpReadHeaderTimeout = flag.Duration("http-read-header-timeout", 10*time.Second, "time to read the request headers, 0 disables the timeout")
+	httpReadTimeout       = flag.Duration("http-read-timeout", 30*time.Second, "time to read the whole request, 0 disables the timeout")
+	httpWriteTimeout      = flag.Duration("http-write-timeout", 60*time.Second, "time from the end of the request headers to the end of the response, 0 disables the timeout")
+	httpIdleTimeout       = flag.Duration("http-idle-timeout", 120*time.Second, "time to wait for the next request on a keep-alive connection, 0 disables the timeout")
+)
+
+type (
+	// thresholdFlag collects repeated --fail-on expressions
+	thresholdFlag []watcher.Threshold
+
+	// ruleFlag collects repeated --rule classification rules
+	ruleFlag []watcher.Rule
+)
+
+func (f *thresholdFlag) String() string {
+	parts := []string{}
+	for _, threshold := range *f {
+		parts = append(parts, threshold.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *thresholdFlag) Set(s string) error {
+	threshold, err := watcher.ParseThreshold(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, threshold)
+	return nil
+}
+
+func (f *ruleFlag) String() string {
+	parts := []string{}
+	for _, rule := range *f {
+		parts = append(parts, rule.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *ruleFlag) Set(s string) error {
+	rule, err := watcher.ParseRule(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, rule)
+	return nil
+}
+
+func main() {
+	flag.Var(&failOn, "fail-on", "fail --once with exit code 1 if the expression matches, e.g. missing>0 or coverage<95%, can be repeated")
+	flag.Var(&rules, "rule", "override the classification of PVCs matching a CEL expression, e.g. excluded:pvc.labels[\"tier\"] == \"cache\", can be repeated")
+	command := ""
+	if len(os.Args) > 1 && (os.Args[1] == ValidateConfigCommand || os.Args[1] == AlertTestsCommand) {
+		command = os.Args[1]
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+	configErrs := []error{}
+	if *configFile != "" {
+		configErrs = loadConfigFile(*configFile)
+	}
+	switch command {
+	case ValidateConfigCommand:
+		os.Exit(runValidateConfig(configErrs))
+	case AlertTestsCommand:
+		os.Exit(runAlertTests(configErrs, flag.Args()))
+	}
+	if errs := append(configErrs, validateFlags()...); len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("invalid configuration: %s", err)
+		}
+		log.Fatalf("invalid configuration, %d problem(s) found", len(errs))
+	}
+
+	config, err := buildConfig()
+	if err != nil {
+		log.Fatalf("invalid configuration: %s", err)
+	}
+	if *exportPolicy != "" {
+		policy, err := watcher.ExportPolicy(*exportPolicy, config)
+		if err != nil {
+			log.Fatalf("unable to export policy: %s", err)
+		}
+		os.Stdout.Write(policy)
+		return
+	}
+
+	if *syslogAddr != "" {
+		sw, err := newSyslogWriter(*syslogAddr)
+		if err != nil {
+			log.Fatalf("unable to configure syslog: %s", err)
+		}
+		// the syslog header carries the timestamp, stderr keeps its own
+		log.SetFlags(0)
+		log.SetOutput(io.MultiWriter(timestampWriter{os.Stderr}, sw))
+	}
+
+	restConfig, err := loadConfig()
+	if err != nil {
+		log.Fatalf("unable to connect to kubernetes: %s", err)
+	}
+	if *impersonateUser != "" {
+		restConfig.Impersonate.UserName = *impersonateUser
+		if *impersonateGroup != "" {
+			restConfig.Impersonate.Groups = strings.Split(*impersonateGroup, ",")
+		}
+		log.Printf("impersonating %s", *impersonateUser)
+	}
+	restConfig.UserAgent = *userAgent
+	if restConfig.UserAgent == "" {
+		restConfig.UserAgent = AppName + "/" + Version
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		log.Fatalf("unable to create kubernetes client: %s", err)
+	}
+
+	// the informers of the factory are started by Run
+	stopper := make(chan struct{}, 1)
+	factory := informers.NewSharedInformerFactory(clientset, watcher.DefaultResync)
+
+	log.Printf("feature gates: %s", config.Features)
+	log.Printf("connecting to k8s and warm-up caches")
+	w := watcher.NewWatcher(factory, config)
+	w.WatchAPIServer(clientset, stopper)
+	if *opaPolicy != "" {
+		if err := w.EnableOPA(strings.Split(*opaPolicy, ","), *opaQuery); err != nil {
+			log.Fatalf("invalid --opa-policy: %s", err)
+		}
+	}
+	if *veleroCRDs || *adHocBackups || *autoSchedules != "" {
+		dynamicClient, err := dynamic.NewForConfig(restConfig)
+		if err != nil {
+			log.Fatalf("unable to create dynamic kubernetes client: %s", err)
+		}
+		if *veleroCRDs {
+			w.EnableVelero(dynamicClient, clientset.Discovery(), *veleroNamespace)
+		}
+		if *adHocBackups {
+			w.EnableAdHocBackups(dynamicClient, *veleroNamespace, *adHocBackupTTL)
+		}
+		if *autoSchedules != "" {
+			err := w.EnableAutoSchedules(dynamicClient, watcher.ScheduleTemplate{
+				Cron:   *autoScheduleCron,
+				TTL:    *autoScheduleTTL,
+				DryRun: *autoSchedules == watcher.AutoScheduleDryRun,
+			})
+			if err != nil {
+				log.Fatalf("invalid --auto-schedules: %s", err)
+			}
+		}
+	}
+	if *hookCommand != "" {
+		w.EnableExecHooks(strings.Fields(*hookCommand))
+	}
+	if *reportWebhook != "" {
+		if err := w.EnableReportWebhook(*reportWebhook, *reportPeriod); err != nil {
+			log.Fatalf("invalid --report-webhook: %s", err)
+		}
+	}
+	if *reportS3Bucket != "" {
+		if err := w.EnableReportS3(reportS3Target(), *reportPeriod, *reportS3Format); err != nil {
+			log.Fatalf("invalid --report-s3-bucket: %s", err)
+		}
+	}
+	if *historyFile != "" {
+		if err := w.EnableHistoryStore(*historyFile, *historyRetention, *historyRollups, stopper); err != nil {
+			log.Fatalf("unable to load --history-file: %s", err)
+		}
+	}
+	if *summaryConfigMap != "" {
+		parts := strings.SplitN(*summaryConfigMap, "/", 2)
+		if len(parts) != 2 {
+			log.Fatalf("invalid --summary-configmap, expected namespace/name")
+		}
+		w.PublishConfigMap(clientset, parts[0], parts[1])
+	}
+	if !w.ValidatePermissions(context.Background(), clientset) {
+		log.Printf("required permissions are missing, the caches may never sync")
+	}
+	if *readOnly {
+		held := w.VerifyReadOnly(context.Background(), clientset)
+		for _, result := range held {
+			log.Printf("%s: %s", result.Name, result.Message)
+		}
+		if len(held) > 0 {
+			log.Fatalf("--read-only refuses to start, %d write permission(s) held or unverifiable", len(held))
+		}
+	}
+
+	if *once {
+		os.Exit(runOnce(w, stopper))
+	}
+	serve(w, clientset, stopper)
+}
+
+func reportS3Target() watcher.S3Target {
+	return watcher.S3Target{
+		Bucket:          *reportS3Bucket,
+		Prefix:          *reportS3Prefix,
+		Region:          *reportS3Region,
+		S3URL:           *reportS3URL,
+		CredentialsFile: *reportS3Credentials,
+		Profile:         *reportS3Profile,
+	}
+}
+
+func remoteWriteTarget() (watcher.RemoteWrite, error) {
+	target := watcher.RemoteWrite{URL: *remoteWriteURL, Interval: *remoteWriteInterval}
+	if err := watcher.ValidateHTTPURL(target.URL); err != nil {
+		return target, fmt.Errorf("invalid --remote-write-url: %w", err)
+	}
+	if target.Interval <= 0 {
+		return target, fmt.Errorf("invalid --remote-write-interval %s, expected a positive duration", target.Interval)
+	}
+	headers, err := parseMarkers(*remoteWriteHeaders)
+	if err != nil {
+		return target, fmt.Errorf("invalid --remote-write-headers: %w", err)
+	}
+	target.Headers = headers
+	labels, err := parseMarkers(*remoteWriteLabels)
+	if err != nil {
+		return target, fmt.Errorf("invalid --remote-write-labels: %w", err)
+	}
+	if _, ok := labels["instance"]; !ok {
+		if hostname, err := os.Hostname(); err == nil {
+			labels["instance"] = hostname
+		}
+	}
+	target.Labels = labels
+	return target, nil
+}
+
+// useColor resolves the --color mode, auto colors terminals unless the
+// NO_COLOR convention or a dumb terminal asks not to
+func useColor(mode string, out *os.File) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := out.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// envOrDefault returns the environment variable if set, else the default
+func envOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// evaluate once after the caches synced and print the report
+func runOnce(w *watcher.Watcher, stopper chan struct{}) int {
+	w.Run(stopper)
+	report := watcher.NewReport(time.Now(), w.EvaluateAll())
+	if err := watcher.WriteReport(os.Stdout, *output, report, useColor(*color, os.Stdout)); err != nil {
+		log.Printf("unable to write report: %s", err)
+		return 2
+	}
+	if *remediationDir != "" {
+		if err := watcher.WriteRemediations(*remediationDir, w.Remediations()); err != nil {
+			log.Printf("unable to write remediations: %s", err)
+			return 2
+		}
+	}
+	code := 0
+	for _, threshold := range failOn {
+		if threshold.Exceeded(report.Summary) {
+			log.Printf("failure threshold %s reached", threshold)
+			code = 1
+		}
+	}
+	return code
+}
+
+// serve the metrics and the http api
+func serve(w *watcher.Watcher, clientset *kubernetes.Clientset, stopper chan struct{}) {
+	// in dry-run mode the metrics are only gathered to log their changes
+	registry := prometheus.DefaultRegisterer
+	base := prometheus.DefaultGatherer
+	if *dryRun {
+		dryRunRegistry := prometheus.NewRegistry()
+		registry, base = dryRunRegistry, dryRunRegistry
+	}
+	err := registry.Register(w)
+	if err != nil {
+		log.Fatalf("unable to register prometheus metrics: %s", err)
+	}
+	gatherer, err := watcher.NewAliasGatherer(base, *metricNames)
+	if err != nil {
+		log.Fatalf("invalid --metric-names: %s", err)
+	}
+
+	sockets, err := activatedSockets()
+	if err != nil {
+		log.Fatalf("unable to use systemd sockets: %s", err)
+	}
+
+	// serve the self test while the caches warm up, everything else is held
+	// back until the first evaluation completed
+	l := newListeners(sockets)
+	if !*dryRun {
+		// the in-flight limit is shared by all addresses serving /metrics
+		metricsHandler := w.RequireReady(metricsHeaders(promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+				ErrorLog:            log.Default(),
+				Registry:            prometheus.DefaultRegisterer,
+				DisableCompression:  !*metricsCompression,
+				MaxRequestsInFlight: *metricsMaxRequests,
+				Timeout:             *metricsTimeout,
+			}),
+		)))
+		err = l.handle(EndpointsMetrics, groupAddrs(*metricsAddrs, sockets), func(mux *endpointMux) {
+			mux.Handle(*metricsPath, metricsHandler)
+		})
+		if err != nil {
+			log.Fatalf("invalid --metrics-addrs: %s", err)
+		}
+	}
+	err = l.handle(EndpointsHealth, groupAddrs(*healthAddrs, sockets), func(mux *endpointMux) {
+		mux.HandleFunc("/ready", w.ReadyHandler)
+		mux.HandleFunc("/selftest", w.SelfTestHandler(clientset))
+	})
+	if err != nil {
+		log.Fatalf("invalid --health-addrs: %s", err)
+	}
+	err = l.handle(EndpointsAPI, groupAddrs(*apiAddrs, sockets), func(mux *endpointMux) {
+		mux.Handle("/api/v1/changes", w.RequireReady(http.HandlerFunc(w.ChangesHandler)))
+		mux.Handle("/api/v1/history", w.RequireReady(http.HandlerFunc(w.HistoryHandler)))
+		mux.Handle("/api/v1/report", w.RequireReady(http.HandlerFunc(w.ReportHandler)))
+		mux.Handle("/api/v1/remediations", w.RequireReady(http.HandlerFunc(w.RemediationsHandler)))
+		mux.HandleFunc("/api/v1/policy", w.PolicyHandler)
+		mux.HandleFunc("/api/v1/config", effectiveConfigHandler)
+		mux.Handle("/api/v1/cardinality", w.RequireReady(watcher.CardinalityHandler(gatherer)))
+		mux.HandleFunc("/openapi.json", watcher.OpenAPIHandler(Version))
+		if *debugToken != "" {
+			mux.Handle("/debug/state", w.RequireReady(w.DebugStateHandler(*debugToken)))
+		}
+	})
+	if err != nil {
+		log.Fatalf("invalid --api-addrs: %s", err)
+	}
+	err = l.serve(serverTimeouts{
+		readHeader: *httpReadHeaderTimeout,
+		read:       *httpReadTimeout,
+		write:      *httpWriteTimeout,
+		idle:       *httpIdleTimeout,
+	})
+	if err != nil {
+		log.Fatalf("unable to serve http: %s", err)
+	}
+	w.Run(stopper)
+
+	w.EvaluateAll()
+	log.Printf("caches synced and first evaluation done, ready")
+	if *dryRun {
+		go watcher.RunDryRun(gatherer, *evaluationJitter, stopper)
+	} else if *remoteWriteURL != "" {
+		target, err := remoteWriteTarget()
+		if err != nil {
+			log.Fatalf("invalid configuration: %s", err)
+		}
+		go w.RunRemoteWrite(gatherer, target, stopper)
+	}
+
+	// dump the internal state on SIGUSR1
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	for range signals {
+		dump, err := json.Marshal(w.DumpState())
+		if err != nil {
+			log.Printf("unable to dump state: %s", err)
+			continue
+		}
+		log.Printf("state dump: %s", dump)
+	}
+}
+
+// metricsHeaders keeps caches from storing a scrape or serving a gzipped
+// response to a client that did not ask for it
+func metricsHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.Header().Add("Vary", "Accept-Encoding")
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// build the watcher config from the flags
+func buildConfig() (watcher.Config, error) {
+	var err error
+	config := watcher.Config{}
+	if *excludeNamespacesRegex != "" {
+		re, err := regexp.Compile(*excludeNamespacesRegex)
+		if err != nil {
+			return config, fmt.Errorf("invalid --exclude-namespaces-regex: %w", err)
+		}
+		config.ExcludeNamespaces = re
+	}
+	if *excludePodsSelector != "" {
+		selector, err := labels.Parse(*excludePodsSelector)
+		if err != nil {
+			return config, fmt.Errorf("invalid --exclude-pods-selector: %w", err)
+		}
+		config.ExcludePods = selector
+	}
+	if *ownerKinds != "" {
+		config.OwnerKinds = map[string]struct{}{}
+		for _, kind := range strings.Split(*ownerKinds, ",") {
+			config.OwnerKinds[strings.TrimSpace(kind)] = struct{}{}
+		}
+	}
+	config.Features, err = watcher.ParseFeatureGates(*featureGates)
+	if err != nil {
+		return config, fmt.Errorf("invalid --feature-gates: %w", err)
+	}
+	config.Rules = rules
+	if *onboardingWindow < 0 || (*onboardingWindow > 0 && *onboardingGrace >= *onboardingWindow) {
+		return config, fmt.Errorf("invalid --onboarding-window %s, has to exceed --onboarding-grace %s", *onboardingWindow, *onboardingGrace)
+	}
+	config.OnboardingWindow = *onboardingWindow
+	config.OnboardingGrace = *onboardingGrace
+	if *snapshotProvisioners != "" {
+		config.SnapshotProvisioners = map[string]struct{}{}
+		for _, provisioner := range strings.Split(*snapshotProvisioners, ",") {
+			config.SnapshotProvisioners[strings.TrimSpace(provisioner)] = struct{}{}
+		}
+	}
+	config.RequireMounted = *requireMounted
+	config.InitOnlyExcluded = *initOnlyExcluded
+	config.EvaluationWorkers = *evaluationWorkers
+	config.EvaluationCache = *evaluationCache
+	config.EvaluationJitter = *evaluationJitter
+	config.LowMemory = *lowMemory
+	config.InspectCronJobs = *inspectCronJobs
+	config.ExcludeDataSources = *excludeDataSources
+	config.StaleBackupAge = *staleBackupAge
+	config.ReadOnly = *readOnly
+	if *tenantMapping != "" {
+		config.Tenants, err = watcher.LoadTenantMapping(*tenantMapping)
+		if err != nil {
+			return config, fmt.Errorf("invalid --tenant-mapping: %w", err)
+		}
+	}
+	config.VirtualNodes = *virtualNodes
+	config.VirtualNodesCSI = *virtualNodesCSI
+	if *namespaceLabels != "" {
+		config.NamespaceLabels = strings.Split(*namespaceLabels, ",")
+	}
+	if *pvcLabelLabels != "" {
+		config.PVCLabels = strings.Split(*pvcLabelLabels, ",")
+	}
+	prices, err := parseMarkers(*storageClassPrices)
+	if err != nil {
+		return config, fmt.Errorf("invalid --storage-class-prices: %w", err)
+	}
+	config.StorageClassPrices = map[string]float64{}
+	for storageClass, price := range prices {
+		config.StorageClassPrices[storageClass], err = strconv.ParseFloat(price, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid price for storage class %s: %w", storageClass, err)
+		}
+	}
+	config.PVCProtected, err = parseMarkers(*pvcProtected)
+	if err != nil {
+		return config, fmt.Errorf("invalid --pvc-protected: %w", err)
+	}
+	config.PVCExcluded, err = parseMarkers(*pvcExcluded)
+	if err != nil {
+		return config, fmt.Errorf("invalid --pvc-excluded: %w", err)
+	}
+	return config, nil
+}
+
+// parse a comma separated list of key=value pairs
+func parseMarkers(s string) (map[string]string, error) {
+	markers := map[string]string{}
+	if s == "" {
+		return markers, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		markers[kv[0]] = kv[1]
+	}
+	return markers, nil
+}
+
+// load matching config, the in-cluster config is used unless --kubeconfig
+// or --context are given. Out of cluster the files of --kubeconfig or
+// KUBECONFIG are merged like kubectl does, exec credential plugins are
+// invoked again when their credentials expire.
+func loadConfig() (*rest.Config, error) {
+	if *kubeconfig == "" && *kubeContext == "" {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			log.Printf("loading k8s config")
+			return config, nil
+		}
+		if err != rest.ErrNotInCluster {
+			return nil, fmt.Errorf("unable to load config: %w", err)
+		}
+	}
+	log.Printf("using out of cluster config...")
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: *kubeContext,
+	})
+	raw, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load config: %w", err)
+	}
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load config: %w", err)
+	}
+	current := raw.CurrentContext
+	if *kubeContext != "" {
+		current = *kubeContext
+	}
+	log.Printf("loading k8s config of context %s", current)
+	return config, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// syslog priority for facility daemon (3) and severity info (6)
+	SyslogPriority = 3*8 + 6
+	SyslogAppName  = AppName
+
+	// SyslogQueueSize is the number of messages buffered while the syslog
+	// endpoint is slow or down, further messages are dropped
+	SyslogQueueSize = 1024
+)
+
+// syslogWriter forwards log lines as RFC5424 messages to a syslog endpoint,
+// the messages are sent in the background so logging never blocks on it
+type syslogWriter struct {
+	network  string
+	addr     string
+	hostname string
+	queue    chan []byte
+	dropped  uint64
+
+	// conn is only used by the sender
+	conn net.Conn
+}
+
+// parseSyslogAddr splits an url like udp://host:514, tcp://host:514 or
+// tls://host:6514 into the protocol and the address
+func parseSyslogAddr(rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to parse syslog address: %w", err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return "", "", fmt.Errorf("unsupported syslog protocol %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("missing syslog host in %q", rawURL)
+	}
+	return u.Scheme, u.Host, nil
+}
+
+// newSyslogWriter creates a syslogWriter from an url like udp://host:514,
+// tcp://host:514 or tls://host:6514 and starts its sender
+func newSyslogWriter(rawURL string) (*syslogWriter, error) {
+	network, addr, err := parseSyslogAddr(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	s := &syslogWriter{
+		network:  network,
+		addr:     addr,
+		hostname: hostname,
+		queue:    make(chan []byte, SyslogQueueSize),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Write queues a single log line, it is dropped if the queue is full
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	select {
+	case s.queue <- s.format(bytes.TrimRight(p, "\n")):
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// run sends the queued messages, reconnecting once if the connection broke.
+// Failures are reported on stderr, the log package would write to syslog.
+func (s *syslogWriter) run() {
+	for msg := range s.queue {
+		if dropped := atomic.SwapUint64(&s.dropped, 0); dropped > 0 {
+			fmt.Fprintf(os.Stderr, "syslog queue is full, dropped %d messages\n", dropped)
+		}
+		if err := s.send(msg); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to write to syslog %s: %s\n", s.addr, err)
+		}
+	}
+}
+
+func (s *syslogWriter) send(msg []byte) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			// a failed tls dial returns a nil *tls.Conn, which must not
+			// end up in the interface
+			conn, err := s.dial()
+			if err != nil {
+				return err
+			}
+			s.conn = conn
+		}
+		if _, err = s.conn.Write(msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// format builds the RFC5424 message, stream transports use octet counting
+// framing as described in RFC6587
+func (s *syslogWriter) format(line []byte) []byte {
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		SyslogPriority,
+		time.Now().UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		SyslogAppName,
+		os.Getpid(),
+		line,
+	)
+	if s.network == "udp" {
+		return []byte(msg)
+	}
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
+
+func (s *syslogWriter) dial() (net.Conn, error) {
+	timeout := 5 * time.Second
+	if s.network == "tls" {
+		dialer := &net.Dialer{Timeout: timeout}
+		return tls.DialWithDialer(dialer, "tcp", s.addr, &tls.Config{})
+	}
+	return net.DialTimeout(s.network, s.addr, timeout)
+}
+
+// timestampWriter prefixes every log line with the date and time like the
+// default flags of the log package, the syslog header carries its own
+// timestamp so the log package writes the lines without one
+type timestampWriter struct {
+	w io.Writer
+}
+
+func (t timestampWriter) Write(p []byte) (int, error) {
+	if _, err := fmt.Fprintf(t.w, "%s %s", time.Now().Format("2006/01/02 15:04:05"), p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
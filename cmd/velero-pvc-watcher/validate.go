@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"bitsbeats/velero-pvc-watcher/pkg/watcher"
+)
+
+const (
+	ValidateConfigCommand = "validate-config"
+)
+
+// validateFlags checks all flags, including the ones only used after
+// connecting to the cluster, and returns every problem found
+func validateFlags() []error {
+	errs := []error{}
+	if _, err := buildConfig(); err != nil {
+		errs = append(errs, err)
+	}
+	switch *output {
+	case watcher.FormatJSON, watcher.FormatYAML, watcher.FormatTable, watcher.FormatSARIF,
+		watcher.FormatCSV, watcher.FormatMarkdown, watcher.FormatHTML:
+	default:
+		errs = append(errs, fmt.Errorf("invalid --output %q, expected json, yaml, table, sarif, csv, markdown or html", *output))
+	}
+	switch *color {
+	case ColorAuto, ColorAlways, ColorNever:
+	default:
+		errs = append(errs, fmt.Errorf("invalid --color %q, expected auto, always or never", *color))
+	}
+	switch *exportPolicy {
+	case "", watcher.PolicyGatekeeper, watcher.PolicyKyverno:
+	default:
+		errs = append(errs, fmt.Errorf("invalid --export-policy %q, expected gatekeeper or kyverno", *exportPolicy))
+	}
+	if _, err := watcher.NewAliasGatherer(prometheus.NewRegistry(), *metricNames); err != nil {
+		errs = append(errs, fmt.Errorf("invalid --metric-names: %w", err))
+	}
+	if *snapshotProvisioners != "" && !*veleroCRDs {
+		errs = append(errs, fmt.Errorf("--snapshot-provisioners requires --velero-crds"))
+	}
+	if *staleBackupAge < 0 {
+		errs = append(errs, fmt.Errorf("invalid --stale-backup-age %s, has to be 0 or positive", *staleBackupAge))
+	} else if *staleBackupAge > 0 && !*veleroCRDs {
+		errs = append(errs, fmt.Errorf("--stale-backup-age requires --velero-crds"))
+	}
+	if *virtualNodesCSI && (!*virtualNodes || !*veleroCRDs) {
+		errs = append(errs, fmt.Errorf("--virtual-nodes-csi requires --virtual-nodes and --velero-crds"))
+	}
+	if *evaluationCache < 0 {
+		errs = append(errs, fmt.Errorf("invalid --evaluation-cache %s, has to be 0 or positive", *evaluationCache))
+	}
+	if *evaluationJitter < 0 {
+		errs = append(errs, fmt.Errorf("invalid --evaluation-jitter %s, has to be 0 or positive", *evaluationJitter))
+	}
+	switch *autoSchedules {
+	case "":
+	case watcher.AutoScheduleDryRun, watcher.AutoScheduleCreate:
+		if !*veleroCRDs {
+			errs = append(errs, fmt.Errorf("--auto-schedules requires --velero-crds"))
+		}
+		if err := watcher.ValidateCron(*autoScheduleCron); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --auto-schedule-cron: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid --auto-schedules %q, expected dry-run or create", *autoSchedules))
+	}
+	if err := watcher.ValidateReportPeriod(*reportPeriod); err != nil {
+		errs = append(errs, fmt.Errorf("invalid --report-period: %w", err))
+	}
+	if *reportWebhook != "" {
+		if err := watcher.ValidateHTTPURL(*reportWebhook); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --report-webhook: %w", err))
+		}
+	}
+	if *readOnly {
+		for _, writer := range []struct {
+			flag    string
+			enabled bool
+		}{
+			{"--summary-configmap", *summaryConfigMap != ""},
+			{"--ad-hoc-backups", *adHocBackups},
+			{"--auto-schedules=create", *autoSchedules == watcher.AutoScheduleCreate},
+		} {
+			if writer.enabled {
+				errs = append(errs, fmt.Errorf("%s writes to the cluster and can not be used with --read-only", writer.flag))
+			}
+		}
+	}
+	if *reportS3Bucket != "" {
+		if err := reportS3Target().Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --report-s3-bucket: %w", err))
+		}
+		if _, err := watcher.NewReportEncoder(*reportS3Format); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --report-s3-format: %w", err))
+		}
+	}
+	if *remoteWriteURL != "" {
+		if _, err := remoteWriteTarget(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := watcher.ValidateHistoryRetention(*historyRetention, *historyRollups); err != nil {
+		errs = append(errs, fmt.Errorf("invalid --history-retention or --history-rollup-retention: %w", err))
+	}
+	if *summaryConfigMap != "" {
+		parts := strings.SplitN(*summaryConfigMap, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			errs = append(errs, fmt.Errorf("invalid --summary-configmap %q, expected namespace/name", *summaryConfigMap))
+		}
+	}
+	if *syslogAddr != "" {
+		if _, _, err := parseSyslogAddr(*syslogAddr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --syslog-addr: %w", err))
+		}
+	}
+	if *opaPolicy != "" {
+		if err := watcher.ValidateOPAPolicy(strings.Split(*opaPolicy, ","), *opaQuery); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --opa-policy: %w", err))
+		}
+		if len(rules) > 0 {
+			errs = append(errs, fmt.Errorf("--opa-policy can not be combined with --rule"))
+		}
+	}
+	if *impersonateUser != "" || *impersonateGroup != "" {
+		if !*once {
+			errs = append(errs, fmt.Errorf("--as and --as-group are only supported with --once"))
+		}
+		if *impersonateUser == "" {
+			errs = append(errs, fmt.Errorf("--as-group requires --as"))
+		}
+	}
+	if !strings.HasPrefix(*metricsPath, "/") || *metricsPath == "/" {
+		errs = append(errs, fmt.Errorf("invalid --metrics-path %q, expected an absolute path other than /", *metricsPath))
+	}
+	for name, addrs := range map[string]string{
+		"listen-addr":   *listenAddr,
+		"metrics-addrs": *metricsAddrs,
+		"health-addrs":  *healthAddrs,
+		"api-addrs":     *apiAddrs,
+	} {
+		if _, err := parseListenAddrs(addrs); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --%s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// runValidateConfig reports the problems of the config file and all flags
+// and returns the exit code, 0 if the configuration is valid
+func runValidateConfig(configErrs []error) int {
+	errs := append(configErrs, validateFlags()...)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "configuration is invalid, %d problem(s) found\n", len(errs))
+		return 1
+	}
+	fmt.Println("configuration is valid")
+	return 0
+}
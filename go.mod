@@ -3,8 +3,15 @@ module bitsbeats/velero-pvc-watcher
 go 1.16
 
 require (
+	github.com/golang/snappy v0.0.4
+	github.com/google/cel-go v0.7.3
+	github.com/open-policy-agent/opa v0.34.2
 	github.com/prometheus/client_golang v1.11.0
+	github.com/prometheus/client_model v0.2.0
+	google.golang.org/genproto v0.0.0-20210602131652-f16073e35f0c
+	google.golang.org/protobuf v1.27.1
 	k8s.io/api v0.22.2
 	k8s.io/apimachinery v0.22.2
 	k8s.io/client-go v0.22.2
+	sigs.k8s.io/yaml v1.2.0
 )
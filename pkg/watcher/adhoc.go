@@ -0,0 +1,126 @@
+package watcher
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// AdHocBackupLabel marks backups created by the watcher
+	AdHocBackupLabel = "velero-pvc-watcher/ad-hoc"
+	// AdHocBackupCooldown is the minimum time between two ad-hoc backups of
+	// the same namespace
+	AdHocBackupCooldown = 10 * time.Minute
+	// AdHocBackupRetry is the minimum time between two attempts to create
+	// an ad-hoc backup of a namespace after a failure
+	AdHocBackupRetry = 5 * time.Minute
+)
+
+// adHocBackups creates a one-off velero backup of a namespace as soon as
+// one of its PVCs changes from missing to protected, namespaces stay pending
+// while they are in the cooldown or the creation failed
+type adHocBackups struct {
+	watcher   *Watcher
+	client    dynamic.Interface
+	namespace string
+	ttl       time.Duration
+
+	mu      sync.Mutex
+	states  map[PVCInfo]string
+	pending map[string]struct{}
+	created map[string]time.Time
+	failed  map[string]time.Time
+}
+
+// EnableAdHocBackups creates velero backups in the velero namespace for
+// namespaces whose PVCs became protected, so the gap closes before the next
+// scheduled run, it has to be called before Run. The backups are created off
+// the evaluation path.
+func (w *Watcher) EnableAdHocBackups(client dynamic.Interface, namespace string, ttl time.Duration) {
+	a := &adHocBackups{
+		watcher:   w,
+		client:    client,
+		namespace: namespace,
+		ttl:       ttl,
+		pending:   map[string]struct{}{},
+		created:   map[string]time.Time{},
+		failed:    map[string]time.Time{},
+	}
+	w.OnEvaluationAsync(a.observe)
+}
+
+func (a *adHocBackups) observe(statuses []PVCStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	states := map[PVCInfo]string{}
+	evaluated := map[string]struct{}{}
+	for _, status := range statuses {
+		states[status.PVCInfo] = status.State
+		evaluated[status.Namespace] = struct{}{}
+		if a.states == nil {
+			continue
+		}
+		if a.states[status.PVCInfo] == StateMissing && status.State == StateProtected {
+			a.pending[status.Namespace] = struct{}{}
+		}
+	}
+	a.states = states
+
+	now := time.Now()
+	for namespace := range a.pending {
+		if _, ok := evaluated[namespace]; !ok {
+			// the namespace or its last PVC was deleted
+			delete(a.pending, namespace)
+			delete(a.failed, namespace)
+			continue
+		}
+		if now.Sub(a.created[namespace]) < AdHocBackupCooldown || now.Sub(a.failed[namespace]) < AdHocBackupRetry {
+			continue
+		}
+		name, err := a.create(namespace)
+		if err != nil {
+			log.Printf("unable to create ad-hoc backup for namespace %s, retrying in %s: %s", namespace, AdHocBackupRetry, err)
+			a.watcher.setHealth(ComponentAdHocBackups, false)
+			a.failed[namespace] = now
+			continue
+		}
+		a.watcher.setHealth(ComponentAdHocBackups, true)
+		delete(a.pending, namespace)
+		delete(a.failed, namespace)
+		a.created[namespace] = now
+		log.Printf("created ad-hoc backup %s/%s for namespace %s", a.namespace, name, namespace)
+	}
+}
+
+func (a *adHocBackups) create(namespace string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	backup := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "velero.io/v1",
+		"kind":       "Backup",
+		"metadata": map[string]interface{}{
+			"generateName": "velero-pvc-watcher-" + namespace + "-",
+			"namespace":    a.namespace,
+			"labels": map[string]interface{}{
+				AdHocBackupLabel: "true",
+			},
+		},
+		"spec": map[string]interface{}{
+			"includedNamespaces": []interface{}{namespace},
+			"ttl":                a.ttl.String(),
+		},
+	}}
+	created, err := a.client.Resource(BackupResource).Namespace(a.namespace).Create(ctx, backup, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return created.GetName(), nil
+}
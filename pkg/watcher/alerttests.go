@@ -0,0 +1,119 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ExampleAlertName is the name of the example alert rule of the README
+	ExampleAlertName = "Velero PVC Check"
+	// ExampleAlertSeverity is the severity label of the example alert rule
+	ExampleAlertSeverity = "warning"
+)
+
+type (
+	// promtoolTests is the unit test file format of `promtool test rules`
+	promtoolTests struct {
+		RuleFiles          []string       `json:"rule_files"`
+		EvaluationInterval string         `json:"evaluation_interval"`
+		Tests              []promtoolTest `json:"tests"`
+	}
+
+	promtoolTest struct {
+		Name           string              `json:"name"`
+		Interval       string              `json:"interval"`
+		InputSeries    []promtoolSeries    `json:"input_series"`
+		AlertRuleTests []promtoolAlertTest `json:"alert_rule_test"`
+	}
+
+	promtoolSeries struct {
+		Series string `json:"series"`
+		Values string `json:"values"`
+	}
+
+	promtoolAlertTest struct {
+		EvalTime  string          `json:"eval_time"`
+		Alertname string          `json:"alertname"`
+		ExpAlerts []promtoolAlert `json:"exp_alerts"`
+	}
+
+	promtoolAlert struct {
+		ExpLabels      map[string]string `json:"exp_labels"`
+		ExpAnnotations map[string]string `json:"exp_annotations"`
+	}
+)
+
+// AlertTests returns promtool unit tests of the example alert rule in the
+// rule files. The input series carry the labels the config exports, so
+// custom tenant, namespace and PVC labels are validated end to end: a
+// missing PVC fires after the pending 10m and resolves once protected. With
+// the metric names mode new the series are named velero_pvc_watcher_*.
+func AlertTests(config Config, metricNames string, ruleFiles []string) ([]byte, error) {
+	prefix := LegacyMetricPrefix
+	if metricNames == MetricNamesNew {
+		prefix = MetricPrefix
+	}
+	_, pvcLabelNames := seriesLabelNames(config)
+	labels := map[string]string{}
+	for _, name := range pvcLabelNames {
+		labels[name] = "example"
+	}
+	labels["namespace"] = "shop"
+	labels["pvc_name"] = "data-redis-0"
+	labels["method"] = MethodFsBackup
+	labels["reason"] = ReasonNoAnnotation
+
+	expLabels := map[string]string{"severity": ExampleAlertSeverity}
+	for name, value := range labels {
+		expLabels[name] = value
+	}
+	firing := promtoolAlert{
+		ExpLabels: expLabels,
+		ExpAnnotations: map[string]string{
+			"text": fmt.Sprintf("The pvc %s in namespace %s has no backup annotation.",
+				labels["pvc_name"], labels["namespace"]),
+			"action": "Either configure a backup or exclude the volume from backup. For more " +
+				"information visit https://github.com/bitsbeats/velero-pvc-watcher",
+			"runbook_url": "https://runbooks.example.com/velero-pvc-watcher#missing-backup",
+			"dashboard":   "https://grafana.example.com/d/velero-pvc-watcher?var-namespace=" + labels["namespace"],
+		},
+	}
+
+	tests := promtoolTests{
+		RuleFiles:          ruleFiles,
+		EvaluationInterval: "1m",
+		Tests: []promtoolTest{{
+			Name:     "missing backup fires and resolves",
+			Interval: "1m",
+			InputSeries: []promtoolSeries{{
+				// missing for 30 minutes, then the series is removed
+				Series: seriesString(prefix+"missing", labels),
+				Values: "1x30 _x30",
+			}},
+			AlertRuleTests: []promtoolAlertTest{
+				{EvalTime: "5m", Alertname: ExampleAlertName, ExpAlerts: []promtoolAlert{}},
+				{EvalTime: "15m", Alertname: ExampleAlertName, ExpAlerts: []promtoolAlert{firing}},
+				{EvalTime: "45m", Alertname: ExampleAlertName, ExpAlerts: []promtoolAlert{}},
+			},
+		}},
+	}
+	return yaml.Marshal(tests)
+}
+
+// seriesString formats a series in the promql notation with sorted labels
+func seriesString(metric string, labels map[string]string) string {
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return metric + "{" + strings.Join(pairs, ",") + "}"
+}
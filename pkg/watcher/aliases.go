@@ -0,0 +1,67 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	LegacyMetricPrefix = "backupmonitor_"
+	MetricPrefix       = "velero_pvc_watcher_"
+
+	MetricNamesLegacy = "legacy"
+	MetricNamesBoth   = "both"
+	MetricNamesNew    = "new"
+)
+
+// aliasGatherer renames the legacy backupmonitor_* metric families to
+// velero_pvc_watcher_*, optionally keeping the legacy names as well so
+// dashboards and alerts can be migrated step by step
+type aliasGatherer struct {
+	gatherer   prometheus.Gatherer
+	keepLegacy bool
+}
+
+// NewAliasGatherer wraps a gatherer according to the metric names mode
+// legacy, both or new
+func NewAliasGatherer(gatherer prometheus.Gatherer, mode string) (prometheus.Gatherer, error) {
+	switch mode {
+	case MetricNamesLegacy:
+		return gatherer, nil
+	case MetricNamesBoth:
+		return &aliasGatherer{gatherer: gatherer, keepLegacy: true}, nil
+	case MetricNamesNew:
+		return &aliasGatherer{gatherer: gatherer}, nil
+	}
+	return nil, fmt.Errorf("unknown metric names mode %q", mode)
+}
+
+func (a *aliasGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := a.gatherer.Gather()
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		name := family.GetName()
+		if !strings.HasPrefix(name, LegacyMetricPrefix) {
+			result = append(result, family)
+			continue
+		}
+		if a.keepLegacy {
+			result = append(result, family)
+		}
+		newName := MetricPrefix + strings.TrimPrefix(name, LegacyMetricPrefix)
+		result = append(result, &dto.MetricFamily{
+			Name:   &newName,
+			Help:   family.Help,
+			Type:   family.Type,
+			Metric: family.Metric,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result, err
+}
@@ -0,0 +1,96 @@
+package watcher
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ChangesHandler serves the state changes since the rfc3339 timestamp given
+// in the `since` query parameter
+func (w *Watcher) ChangesHandler(rw http.ResponseWriter, r *http.Request) {
+	since, ok := parseSince(rw, r)
+	if !ok {
+		return
+	}
+	writeJSON(rw, http.StatusOK, w.changes.Since(since))
+}
+
+// HistoryHandler serves the evaluation summaries seen after the rfc3339
+// timestamp given in the `since` query parameter
+func (w *Watcher) HistoryHandler(rw http.ResponseWriter, r *http.Request) {
+	since, ok := parseSince(rw, r)
+	if !ok {
+		return
+	}
+	writeJSON(rw, http.StatusOK, w.history.Since(since))
+}
+
+// parseSince parses the optional `since` query parameter, on failure the
+// error response is written
+func parseSince(rw http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		http.Error(rw, "invalid since parameter, expected rfc3339", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// DebugStateHandler serves the evaluation model of all namespaces, requests
+// have to authenticate with the bearer token
+func (w *Watcher) DebugStateHandler(token string) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(authorization, "Bearer ")
+		if given == authorization || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		writeJSON(rw, http.StatusOK, w.DebugState())
+	}
+}
+
+// ReportHandler serves the report of the latest evaluation in the format
+// given in the `format` query parameter, json if empty
+func (w *Watcher) ReportHandler(rw http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSON
+	}
+	encoder, err := NewReportEncoder(format)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := &bytes.Buffer{}
+	if err := encoder.EncodeReport(body, NewReport(time.Now(), w.EvaluateAll())); err != nil {
+		log.Printf("unable to encode report: %s", err)
+		http.Error(rw, "unable to encode report", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", encoder.ContentType())
+	rw.Write(body.Bytes())
+}
+
+// RemediationsHandler serves the remediation patches as json
+func (w *Watcher) RemediationsHandler(rw http.ResponseWriter, r *http.Request) {
+	writeJSON(rw, http.StatusOK, w.Remediations())
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	err := json.NewEncoder(rw).Encode(v)
+	if err != nil {
+		log.Printf("unable to write response: %s", err)
+	}
+}
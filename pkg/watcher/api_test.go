@@ -0,0 +1,45 @@
+package watcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestDebugStateHandler(t *testing.T) {
+	w := newTestWatcher(t, Config{},
+		testNamespace("shop", false, v1.NamespaceActive),
+		testNamespace("old-shop", true, v1.NamespaceTerminating),
+		testPVC("shop", "data"),
+		testPVC("old-shop", "data"),
+	)
+	handler := w.DebugStateHandler("secret")
+	tests := []struct {
+		authorization string
+		status        int
+	}{
+		{"", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"bearer secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/debug/state", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("authorization %q got status %d, expected %d", test.authorization, rec.Code, test.status)
+		}
+	}
+
+	state := w.DebugState()
+	if len(state) != 1 || state[0].Namespace != "shop" {
+		t.Errorf("expected only the active namespace shop, got %+v", state)
+	}
+}
@@ -0,0 +1,63 @@
+package watcher
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// APIServerProbeInterval is the interval of the apiserver /version probe
+	APIServerProbeInterval = 30 * time.Second
+)
+
+// requestLatency records the latency of all client-go requests
+type requestLatency struct {
+	histogram *prometheus.HistogramVec
+}
+
+func (r requestLatency) Observe(_ context.Context, verb string, _ url.URL, latency time.Duration) {
+	r.histogram.WithLabelValues(verb).Observe(latency.Seconds())
+}
+
+// WatchAPIServer probes the apiserver /version endpoint periodically and
+// records the latency of all requests of the watcher, so a quiet cluster can
+// be told apart from lost connectivity
+func (w *Watcher) WatchAPIServer(client kubernetes.Interface, stopper <-chan struct{}) {
+	metrics.Register(metrics.RegisterOpts{
+		RequestLatency: requestLatency{w.promRequestDuration},
+	})
+	go func() {
+		ticker := time.NewTicker(APIServerProbeInterval)
+		defer ticker.Stop()
+		reachable := true
+		for {
+			err := probeAPIServer(client)
+			if err != nil && reachable {
+				log.Printf("apiserver is not reachable: %s", err)
+			} else if err == nil && !reachable {
+				log.Printf("apiserver is reachable again")
+			}
+			reachable = err == nil
+			w.promAPIServerReachable.Set(boolValue(reachable))
+			w.setHealth(ComponentAPIServer, reachable)
+			select {
+			case <-stopper:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func probeAPIServer(client kubernetes.Interface) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return client.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+}
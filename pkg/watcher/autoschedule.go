@@ -0,0 +1,158 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	AutoScheduleDryRun = "dry-run"
+	AutoScheduleCreate = "create"
+
+	// AutoScheduleLabel marks schedules created by the watcher
+	AutoScheduleLabel = "velero-pvc-watcher/auto-schedule"
+	// AutoScheduleRetry is the minimum time between two attempts to create
+	// the schedule of a namespace after a failure
+	AutoScheduleRetry = 5 * time.Minute
+)
+
+type (
+	// ScheduleTemplate configures the schedules created for uncovered
+	// namespaces
+	ScheduleTemplate struct {
+		// Cron is the velero schedule expression, e.g. "0 2 * * *"
+		Cron string
+		// TTL of the backups created by the schedule
+		TTL time.Duration
+		// DryRun only validates the schedules on the apiserver and logs them
+		DryRun bool
+	}
+
+	// autoSchedules creates a velero schedule for every namespace with PVCs
+	// to back up that is not covered by any schedule
+	autoSchedules struct {
+		watcher  *Watcher
+		client   dynamic.Interface
+		velero   *veleroInformers
+		template ScheduleTemplate
+
+		mu      sync.Mutex
+		handled map[string]struct{}
+		failed  map[string]time.Time
+	}
+)
+
+// EnableAutoSchedules creates schedules from the template for namespaces with
+// protected, missing or unmounted PVCs that no schedule covers, namespaces
+// whose PVCs are all excluded or unmanaged need none. It requires
+// EnableVelero and has to be called before Run, the schedules are created
+// off the evaluation path.
+func (w *Watcher) EnableAutoSchedules(client dynamic.Interface, template ScheduleTemplate) error {
+	if w.velero == nil {
+		return fmt.Errorf("automatic schedules require the velero custom resources")
+	}
+	if err := ValidateCron(template.Cron); err != nil {
+		return err
+	}
+	a := &autoSchedules{
+		watcher:  w,
+		client:   client,
+		velero:   w.velero,
+		template: template,
+		handled:  map[string]struct{}{},
+		failed:   map[string]time.Time{},
+	}
+	w.OnEvaluationAsync(a.observe)
+	return nil
+}
+
+func (a *autoSchedules) observe(statuses []PVCStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	namespaces := map[string]struct{}{}
+	for _, status := range statuses {
+		if status.State != StateExcluded && status.State != StateUnmanaged {
+			namespaces[status.Namespace] = struct{}{}
+		}
+	}
+	schedules := a.velero.listSchedules()
+	now := time.Now()
+	for namespace := range namespaces {
+		if _, ok := a.handled[namespace]; ok {
+			continue
+		}
+		if now.Sub(a.failed[namespace]) < AutoScheduleRetry {
+			continue
+		}
+		covered := false
+		for _, schedule := range schedules {
+			if scheduleCovers(schedule, namespace) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+		name, err := a.create(namespace)
+		if err != nil {
+			log.Printf("unable to create schedule for namespace %s, retrying in %s: %s", namespace, AutoScheduleRetry, err)
+			a.watcher.setHealth(ComponentAutoSchedules, false)
+			a.failed[namespace] = now
+			continue
+		}
+		// the schedule informer may lag behind, a created schedule is not
+		// created again
+		a.handled[namespace] = struct{}{}
+		delete(a.failed, namespace)
+		a.watcher.setHealth(ComponentAutoSchedules, true)
+		if a.template.DryRun {
+			log.Printf("dry-run: would create schedule %s/%s for namespace %s", a.velero.namespace, name, namespace)
+			continue
+		}
+		log.Printf("created schedule %s/%s for namespace %s", a.velero.namespace, name, namespace)
+	}
+}
+
+func (a *autoSchedules) create(namespace string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	name := "velero-pvc-watcher-" + namespace
+	schedule := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "velero.io/v1",
+		"kind":       "Schedule",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": a.velero.namespace,
+			"labels": map[string]interface{}{
+				AutoScheduleLabel: "true",
+			},
+		},
+		"spec": map[string]interface{}{
+			"schedule": a.template.Cron,
+			"template": map[string]interface{}{
+				"includedNamespaces": []interface{}{namespace},
+				"ttl":                a.template.TTL.String(),
+			},
+		},
+	}}
+	options := metav1.CreateOptions{}
+	if a.template.DryRun {
+		options.DryRun = []string{metav1.DryRunAll}
+	}
+	_, err := a.client.Resource(ScheduleResource).Namespace(a.velero.namespace).Create(ctx, schedule, options)
+	if apierrors.IsAlreadyExists(err) {
+		return name, nil
+	}
+	return name, err
+}
@@ -0,0 +1,70 @@
+package watcher
+
+import (
+	"log"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// PreBackupHookPrefix is the annotation prefix of velero pre backup hooks
+	PreBackupHookPrefix = "pre.hook.backup.velero.io/"
+	// PostBackupHookPrefix is the annotation prefix of velero post backup hooks
+	PostBackupHookPrefix = "post.hook.backup.velero.io/"
+)
+
+// backupHooks returns the velero backup hooks annotated on the pod, e.g.
+// "pre,post", empty if none
+func backupHooks(pod *v1.Pod) string {
+	hooks := []string{}
+	for _, hook := range []struct{ name, prefix string }{
+		{"pre", PreBackupHookPrefix},
+		{"post", PostBackupHookPrefix},
+	} {
+		for key := range pod.GetAnnotations() {
+			if strings.HasPrefix(key, hook.prefix) {
+				hooks = append(hooks, hook.name)
+				break
+			}
+		}
+	}
+	return strings.Join(hooks, ",")
+}
+
+// collectBackupHooks flags pods with velero backup hooks that mount missing
+// PVCs, the hooks show a backup was intended but the volumes were not listed
+func (w *Watcher) collectBackupHooks(statuses []PVCStatus) {
+	w.promBackupHooks.Reset()
+	missing := map[PVCInfo]bool{}
+	for _, status := range statuses {
+		if status.State == StateMissing {
+			missing[status.PVCInfo] = true
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	pods, err := w.podInformer.Lister().List(labels.Everything())
+	if err != nil {
+		log.Printf("unable to list pods: %s", err)
+		return
+	}
+	for _, pod := range pods {
+		hooks := backupHooks(pod)
+		if hooks == "" || w.isExcludedNamespace(pod.GetNamespace()) {
+			continue
+		}
+		unprotected := 0
+		for _, pvcName := range claimNames(pod) {
+			if missing[PVCInfo{Namespace: pod.GetNamespace(), PVCName: pvcName}] {
+				unprotected++
+			}
+		}
+		if unprotected == 0 {
+			continue
+		}
+		w.promBackupHooks.WithLabelValues(pod.GetNamespace(), pod.GetName(), hooks).Set(float64(unprotected))
+	}
+}
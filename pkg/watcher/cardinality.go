@@ -0,0 +1,94 @@
+package watcher
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type (
+	// Cardinality summarizes the series exported per metric and namespace
+	Cardinality struct {
+		Series     int               `json:"series"`
+		Metrics    []SeriesCount     `json:"metrics"`
+		Namespaces []NamespaceSeries `json:"namespaces"`
+	}
+
+	// SeriesCount is the number of series of a metric
+	SeriesCount struct {
+		Name   string `json:"name"`
+		Series int    `json:"series"`
+	}
+
+	// NamespaceSeries is the number of series labeled with a namespace
+	NamespaceSeries struct {
+		Namespace string `json:"namespace"`
+		Series    int    `json:"series"`
+	}
+)
+
+// NewCardinality counts the series of the gathered metric families, the
+// buckets, sum and count of histograms and summaries are separate series
+func NewCardinality(families []*dto.MetricFamily) Cardinality {
+	c := Cardinality{Metrics: []SeriesCount{}, Namespaces: []NamespaceSeries{}}
+	namespaces := map[string]int{}
+	for _, family := range families {
+		count := 0
+		for _, metric := range family.Metric {
+			series := metricSeries(family.GetType(), metric)
+			count += series
+			for _, label := range metric.Label {
+				if label.GetName() == "namespace" {
+					namespaces[label.GetValue()] += series
+				}
+			}
+		}
+		c.Series += count
+		c.Metrics = append(c.Metrics, SeriesCount{Name: family.GetName(), Series: count})
+	}
+	for namespace, count := range namespaces {
+		c.Namespaces = append(c.Namespaces, NamespaceSeries{Namespace: namespace, Series: count})
+	}
+
+	// largest first, so the namespaces about to blow up are on top
+	sort.Slice(c.Metrics, func(i, j int) bool {
+		if c.Metrics[i].Series != c.Metrics[j].Series {
+			return c.Metrics[i].Series > c.Metrics[j].Series
+		}
+		return c.Metrics[i].Name < c.Metrics[j].Name
+	})
+	sort.Slice(c.Namespaces, func(i, j int) bool {
+		if c.Namespaces[i].Series != c.Namespaces[j].Series {
+			return c.Namespaces[i].Series > c.Namespaces[j].Series
+		}
+		return c.Namespaces[i].Namespace < c.Namespaces[j].Namespace
+	})
+	return c
+}
+
+func metricSeries(kind dto.MetricType, metric *dto.Metric) int {
+	switch kind {
+	case dto.MetricType_HISTOGRAM:
+		// the +Inf bucket is implicit
+		return len(metric.GetHistogram().GetBucket()) + 3
+	case dto.MetricType_SUMMARY:
+		return len(metric.GetSummary().GetQuantile()) + 2
+	}
+	return 1
+}
+
+// CardinalityHandler serves the number of series per metric and namespace of
+// the gatherer as json
+func CardinalityHandler(gatherer prometheus.Gatherer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		families, err := gatherer.Gather()
+		if err != nil {
+			// the families gathered so far are still counted
+			log.Printf("unable to gather all metrics: %s", err)
+		}
+		writeJSON(rw, http.StatusOK, NewCardinality(families))
+	}
+}
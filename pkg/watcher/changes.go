@@ -0,0 +1,77 @@
+package watcher
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	ChangeLogSize = 1024
+)
+
+type (
+	// Change describes a transition of a PVC between two states, an empty
+	// From marks a new PVC and an empty To a removed one
+	Change struct {
+		Time      time.Time `json:"time"`
+		Namespace string    `json:"namespace"`
+		PVCName   string    `json:"pvc_name"`
+		From      string    `json:"from"`
+		To        string    `json:"to"`
+	}
+
+	// ChangeLog is a fixed size ring buffer of state changes
+	ChangeLog struct {
+		mu      sync.RWMutex
+		entries []Change
+		next    int
+		full    bool
+	}
+)
+
+// logChange logs a state change with logfmt fields, the event is the new
+// state like newly_missing or removed for deleted PVCs
+func logChange(change Change, reason string) {
+	event := "removed"
+	if change.To != "" {
+		event = "newly_" + change.To
+	}
+	log.Printf("pvc %s namespace=%s pvc_name=%s from=%s to=%s reason=%q",
+		event, change.Namespace, change.PVCName, orDash(change.From), orDash(change.To), reason)
+}
+
+// NewChangeLog creates a ChangeLog holding the last size changes
+func NewChangeLog(size int) *ChangeLog {
+	return &ChangeLog{
+		entries: make([]Change, size),
+	}
+}
+
+// Add stores a change, overwriting the oldest one if the buffer is full
+func (c *ChangeLog) Add(change Change) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[c.next] = change
+	c.next = (c.next + 1) % len(c.entries)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// Since returns all buffered changes after t, oldest first
+func (c *ChangeLog) Since(t time.Time) []Change {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ordered := c.entries[:c.next]
+	if c.full {
+		ordered = append(append([]Change{}, c.entries[c.next:]...), c.entries[:c.next]...)
+	}
+	changes := []Change{}
+	for _, change := range ordered {
+		if change.Time.After(t) {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	ConfigMapKey = "summary.json"
+)
+
+// configMapPublisher writes the coverage summary into a ConfigMap
+type configMapPublisher struct {
+	watcher   *Watcher
+	client    kubernetes.Interface
+	namespace string
+	name      string
+
+	pending chan Summary
+	last    []byte
+}
+
+// PublishConfigMap writes the coverage summary of every evaluation into
+// the ConfigMap namespace/name, unchanged summaries are skipped
+func (w *Watcher) PublishConfigMap(client kubernetes.Interface, namespace, name string) {
+	p := &configMapPublisher{
+		watcher:   w,
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		pending:   make(chan Summary, 1),
+	}
+	go p.run()
+	w.OnEvaluation(func(statuses []PVCStatus) {
+		summary := Summarize(time.Now(), statuses)
+		// replace a summary that was not written yet
+		select {
+		case <-p.pending:
+		default:
+		}
+		p.pending <- summary
+	})
+}
+
+func (p *configMapPublisher) run() {
+	for summary := range p.pending {
+		compare := summary
+		compare.Time = time.Time{}
+		key, _ := json.Marshal(compare)
+		if string(key) == string(p.last) {
+			continue
+		}
+		data, err := json.Marshal(summary)
+		if err != nil {
+			log.Printf("unable to encode summary: %s", err)
+			continue
+		}
+		if err := p.write(data); err != nil {
+			log.Printf("unable to publish summary to configmap %s/%s: %s", p.namespace, p.name, err)
+			p.watcher.setHealth(ComponentConfigMap, false)
+			continue
+		}
+		p.watcher.setHealth(ComponentConfigMap, true)
+		p.last = key
+	}
+}
+
+func (p *configMapPublisher) write(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	configMaps := p.client.CoreV1().ConfigMaps(p.namespace)
+	cm, err := configMaps.Get(ctx, p.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      p.name,
+				Namespace: p.namespace,
+			},
+			Data: map[string]string{ConfigMapKey: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[ConfigMapKey] = string(data)
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,359 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+
+	FormatCSV = "csv"
+
+	// ReportTimeout limits a single delivery of a report
+	ReportTimeout = 30 * time.Second
+	// ReportRetries is the number of times a failed delivery is retried
+	// every ReportRetryInterval
+	ReportRetries       = 5
+	ReportRetryInterval = time.Minute
+)
+
+type (
+	// CoverageReport is the coverage summary of a reporting period, gaps
+	// are PVCs that became missing, resolved gaps PVCs that are no longer
+	// missing
+	CoverageReport struct {
+		Period       string                       `json:"period"`
+		From         time.Time                    `json:"from"`
+		To           time.Time                    `json:"to"`
+		Total        int                          `json:"total"`
+		Coverage     float64                      `json:"coverage"`
+		Delta        CoverageDelta                `json:"delta"`
+		Namespaces   map[string]NamespaceCoverage `json:"namespaces"`
+		NewGaps      []CoverageGap                `json:"new_gaps"`
+		ResolvedGaps []CoverageGap                `json:"resolved_gaps"`
+	}
+
+	// CoverageGap is a PVC that became missing or is no longer missing, State
+	// is its state at the end of the period, empty if it was deleted
+	CoverageGap struct {
+		Namespace string `json:"namespace"`
+		PVCName   string `json:"pvc_name"`
+		State     string `json:"state"`
+	}
+
+	// NamespaceCoverage is the coverage of a namespace at the end of the
+	// period and its change since the start
+	NamespaceCoverage struct {
+		Total    int           `json:"total"`
+		Missing  int           `json:"missing"`
+		Coverage float64       `json:"coverage"`
+		Delta    CoverageDelta `json:"delta"`
+	}
+
+	// CoverageDelta is the change of the counts and the coverage since the
+	// start of the period
+	CoverageDelta struct {
+		Total    int     `json:"total"`
+		Missing  int     `json:"missing"`
+		Coverage float64 `json:"coverage"`
+	}
+
+	// reportSink delivers a report, e.g. to a webhook
+	reportSink struct {
+		name    string
+		deliver func(report CoverageReport) error
+	}
+
+	// reportScheduler compiles a report at the end of every period and
+	// hands it to the sinks
+	reportScheduler struct {
+		watcher *Watcher
+		period  string
+		sinks   []reportSink
+		reports chan CoverageReport
+
+		mu     sync.Mutex
+		from   time.Time
+		next   time.Time
+		start  map[PVCInfo]string
+		counts Summary
+	}
+)
+
+// ValidateReportPeriod checks that period is weekly or monthly
+func ValidateReportPeriod(period string) error {
+	switch period {
+	case ReportWeekly, ReportMonthly:
+		return nil
+	}
+	return fmt.Errorf("unknown period %q, expected weekly or monthly", period)
+}
+
+// EnableReportWebhook posts a json coverage report to the url at the end of
+// every weekly or monthly period, it has to be called before Run
+func (w *Watcher) EnableReportWebhook(url, period string) error {
+	if err := ValidateHTTPURL(url); err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: ReportTimeout}
+	return w.enableReports(period, reportSink{
+		name: "webhook",
+		deliver: func(report CoverageReport) error {
+			return postReport(client, url, report)
+		},
+	})
+}
+
+// enableReports adds a sink to the report scheduler, all sinks share the
+// period
+func (w *Watcher) enableReports(period string, sink reportSink) error {
+	if err := ValidateReportPeriod(period); err != nil {
+		return err
+	}
+	if w.reports != nil {
+		if w.reports.period != period {
+			return fmt.Errorf("report period %s conflicts with %s", period, w.reports.period)
+		}
+		w.reports.sinks = append(w.reports.sinks, sink)
+		return nil
+	}
+	w.reports = &reportScheduler{
+		watcher: w,
+		period:  period,
+		sinks:   []reportSink{sink},
+		reports: make(chan CoverageReport, 1),
+	}
+	go w.reports.run()
+	w.OnEvaluation(w.reports.observe)
+	return nil
+}
+
+// observe starts the first period with the first evaluation and compiles
+// the report with the first evaluation after a period ended
+func (r *reportScheduler) observe(statuses []PVCStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.start != nil && now.Before(r.next) {
+		return
+	}
+	if r.start != nil {
+		report := compileReport(r.period, r.from, now, r.counts, r.start, statuses)
+		select {
+		case r.reports <- report:
+		default:
+			log.Printf("previous %s report is still being delivered, dropping the report of %s", r.period, r.from.Format(time.RFC3339))
+		}
+	}
+	r.from = now
+	r.next = nextPeriod(r.period, now)
+	r.counts = Summarize(now, statuses)
+	r.start = make(map[PVCInfo]string, len(statuses))
+	for _, status := range statuses {
+		r.start[status.PVCInfo] = status.State
+	}
+}
+
+func (r *reportScheduler) run() {
+	for report := range r.reports {
+		for _, sink := range r.sinks {
+			err := sink.deliver(report)
+			for attempt := 0; err != nil && attempt < ReportRetries; attempt++ {
+				log.Printf("unable to deliver %s report to %s, retrying in %s: %s", report.Period, sink.name, ReportRetryInterval, err)
+				time.Sleep(ReportRetryInterval)
+				err = sink.deliver(report)
+			}
+			if err != nil {
+				log.Printf("unable to deliver %s report to %s: %s", report.Period, sink.name, err)
+				r.watcher.setHealth(ComponentReports, false)
+				continue
+			}
+			r.watcher.setHealth(ComponentReports, true)
+		}
+	}
+}
+
+// nextPeriod returns the start of the period after t: the next monday or
+// the first of the next month, midnight UTC
+func nextPeriod(period string, t time.Time) time.Time {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if period == ReportMonthly {
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := (8 - int(midnight.Weekday())) % 7
+	if days == 0 {
+		days = 7
+	}
+	return midnight.AddDate(0, 0, days)
+}
+
+// compileReport compares the statuses with the states at the start of the
+// period
+func compileReport(period string, from, to time.Time, start Summary, states map[PVCInfo]string, statuses []PVCStatus) CoverageReport {
+	end := Summarize(to, statuses)
+	report := CoverageReport{
+		Period:   period,
+		From:     from,
+		To:       to,
+		Total:    end.Total,
+		Coverage: end.Coverage,
+		Delta: CoverageDelta{
+			Total:    end.Total - start.Total,
+			Missing:  end.States[StateMissing] - start.States[StateMissing],
+			Coverage: end.Coverage - start.Coverage,
+		},
+		Namespaces:   map[string]NamespaceCoverage{},
+		NewGaps:      []CoverageGap{},
+		ResolvedGaps: []CoverageGap{},
+	}
+	for name, ns := range end.Namespaces {
+		before, ok := start.Namespaces[name]
+		if !ok {
+			before.Coverage = 1
+		}
+		report.Namespaces[name] = NamespaceCoverage{
+			Total:    ns.Total,
+			Missing:  ns.States[StateMissing],
+			Coverage: ns.Coverage,
+			Delta: CoverageDelta{
+				Total:    ns.Total - before.Total,
+				Missing:  ns.States[StateMissing] - before.States[StateMissing],
+				Coverage: ns.Coverage - before.Coverage,
+			},
+		}
+	}
+	for name, before := range start.Namespaces {
+		if _, ok := end.Namespaces[name]; ok {
+			continue
+		}
+		report.Namespaces[name] = NamespaceCoverage{
+			Coverage: 1,
+			Delta: CoverageDelta{
+				Total:    -before.Total,
+				Missing:  -before.States[StateMissing],
+				Coverage: 1 - before.Coverage,
+			},
+		}
+	}
+
+	current := make(map[PVCInfo]bool, len(statuses))
+	for _, status := range statuses {
+		current[status.PVCInfo] = true
+		gap := CoverageGap{Namespace: status.Namespace, PVCName: status.PVCName, State: status.State}
+		if status.State == StateMissing && states[status.PVCInfo] != StateMissing {
+			report.NewGaps = append(report.NewGaps, gap)
+		}
+		if status.State != StateMissing && states[status.PVCInfo] == StateMissing {
+			report.ResolvedGaps = append(report.ResolvedGaps, gap)
+		}
+	}
+	// deleted PVCs no longer need a backup
+	for info, state := range states {
+		if state == StateMissing && !current[info] {
+			report.ResolvedGaps = append(report.ResolvedGaps, CoverageGap{Namespace: info.Namespace, PVCName: info.PVCName})
+		}
+	}
+	sortGaps(report.NewGaps)
+	sortGaps(report.ResolvedGaps)
+	return report
+}
+
+func sortGaps(gaps []CoverageGap) {
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].Namespace != gaps[j].Namespace {
+			return gaps[i].Namespace < gaps[j].Namespace
+		}
+		return gaps[i].PVCName < gaps[j].PVCName
+	})
+}
+
+func postReport(client *http.Client, url string, report CoverageReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("unable to encode report: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ReportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// WriteCoverageReport writes the report as json, markdown, html or as csv
+// with one row per namespace
+func WriteCoverageReport(out io.Writer, format string, report CoverageReport) error {
+	encoder, err := NewReportEncoder(format)
+	if err != nil {
+		return err
+	}
+	return encoder.EncodeCoverageReport(out, report)
+}
+
+func writeCoverageCSV(out io.Writer, report CoverageReport) error {
+	newGaps, resolvedGaps := map[string]int{}, map[string]int{}
+	for _, gap := range report.NewGaps {
+		newGaps[gap.Namespace]++
+	}
+	for _, gap := range report.ResolvedGaps {
+		resolvedGaps[gap.Namespace]++
+	}
+	names := coverageNamespaces(report)
+
+	writer := csv.NewWriter(out)
+	writer.Write([]string{
+		"namespace", "total", "missing", "coverage",
+		"delta_total", "delta_missing", "delta_coverage",
+		"new_gaps", "resolved_gaps",
+	})
+	for _, name := range names {
+		ns := report.Namespaces[name]
+		writer.Write([]string{
+			name,
+			strconv.Itoa(ns.Total),
+			strconv.Itoa(ns.Missing),
+			strconv.FormatFloat(ns.Coverage, 'f', 4, 64),
+			strconv.Itoa(ns.Delta.Total),
+			strconv.Itoa(ns.Delta.Missing),
+			strconv.FormatFloat(ns.Delta.Coverage, 'f', 4, 64),
+			strconv.Itoa(newGaps[name]),
+			strconv.Itoa(resolvedGaps[name]),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ValidateHTTPURL checks that the url is an absolute http(s) url
+func ValidateHTTPURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("expected an http(s) url, got %q", rawURL)
+	}
+	return nil
+}
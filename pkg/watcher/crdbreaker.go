@@ -0,0 +1,169 @@
+package watcher
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// CRDProbeInterval is the interval an installed CRD is checked for
+	// removal
+	CRDProbeInterval = 30 * time.Second
+	// CRDRetryMin and CRDRetryMax bound the exponential backoff of probing
+	// a missing CRD
+	CRDRetryMin = 10 * time.Second
+	CRDRetryMax = 5 * time.Minute
+)
+
+type (
+	// crdInformer runs an informer of a custom resource only while its CRD
+	// is installed. Without the CRD the informer would error-loop against
+	// the apiserver and never sync, instead the breaker probes the discovery
+	// API with backoff and restarts the informer once the CRD (re)appears.
+	crdInformer struct {
+		name      string
+		resource  schema.GroupVersionResource
+		client    dynamic.Interface
+		discovery discovery.DiscoveryInterface
+		// onStart is called with every new informer before it runs
+		onStart func(namedInformer)
+
+		mu        sync.Mutex
+		informer  informers.GenericInformer
+		stop      chan struct{}
+		available bool
+		probed    bool
+	}
+)
+
+func newCRDInformer(name string, resource schema.GroupVersionResource, client dynamic.Interface, discovery discovery.DiscoveryInterface) *crdInformer {
+	return &crdInformer{
+		name:      name,
+		resource:  resource,
+		client:    client,
+		discovery: discovery,
+		onStart:   func(namedInformer) {},
+	}
+}
+
+// Lister lists the cached objects, none while the CRD is missing
+func (c *crdInformer) Lister() cache.GenericLister {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.informer == nil {
+		return cache.NewGenericLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}), c.resource.GroupResource())
+	}
+	return c.informer.Lister()
+}
+
+// namedInformers returns the informer while it runs
+func (c *crdInformer) namedInformers() []namedInformer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.informer == nil {
+		return nil
+	}
+	return []namedInformer{{c.name, c.informer.Informer()}}
+}
+
+// Available reports if the CRD was installed at the last probe
+func (c *crdInformer) Available() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.available
+}
+
+// run probes the CRD once and waits for the informer to sync if it is
+// installed, then keeps probing in the background until stopper is closed
+func (c *crdInformer) run(stopper chan struct{}) {
+	c.probe()
+	go func() {
+		retry := CRDRetryMin
+		for {
+			wait := CRDProbeInterval
+			if !c.Available() {
+				wait = retry
+				retry *= 2
+				if retry > CRDRetryMax {
+					retry = CRDRetryMax
+				}
+			} else {
+				retry = CRDRetryMin
+			}
+			select {
+			case <-stopper:
+				c.mu.Lock()
+				if c.stop != nil {
+					close(c.stop)
+					c.stop = nil
+				}
+				c.mu.Unlock()
+				return
+			case <-time.After(wait):
+			}
+			c.probe()
+		}
+	}()
+}
+
+// probe checks the discovery API for the resource and starts or stops the
+// informer on a change, errors other than a missing group keep the state
+func (c *crdInformer) probe() {
+	installed := false
+	resources, err := c.discovery.ServerResourcesForGroupVersion(c.resource.GroupVersion().String())
+	switch {
+	case err == nil:
+		for _, resource := range resources.APIResources {
+			if resource.Name == c.resource.Resource {
+				installed = true
+			}
+		}
+	case apierrors.IsNotFound(err):
+	default:
+		log.Printf("unable to discover %s: %s", c.name, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !installed && (c.available || !c.probed) {
+		log.Printf("%s are not installed, probing with backoff", c.name)
+	}
+	c.available, c.probed = installed, true
+	switch {
+	case installed && c.informer == nil:
+		informer := dynamicinformer.NewFilteredDynamicInformer(c.client, c.resource, "", DefaultResync,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil)
+		stop := make(chan struct{})
+		c.onStart(namedInformer{c.name, informer.Informer()})
+		go informer.Informer().Run(stop)
+		// unlocked while syncing, listers keep returning the empty lister,
+		// the sync is given up if the CRD is removed in between
+		c.mu.Unlock()
+		timeout := make(chan struct{})
+		timer := time.AfterFunc(CRDProbeInterval, func() { close(timeout) })
+		synced := cache.WaitForCacheSync(timeout, informer.Informer().HasSynced)
+		timer.Stop()
+		c.mu.Lock()
+		if !synced {
+			log.Printf("failed to sync %s, retrying", c.name)
+			close(stop)
+			c.available = false
+			return
+		}
+		c.informer, c.stop = informer, stop
+		log.Printf("%s are installed, watching them", c.name)
+	case !installed && c.informer != nil:
+		close(c.stop)
+		c.informer, c.stop = nil, nil
+	}
+}
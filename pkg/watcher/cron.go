@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// cronField is the allowed range and names of a cron expression field
+	cronField struct {
+		name     string
+		min, max int
+		names    []string
+	}
+)
+
+var (
+	cronFields = []cronField{
+		{"minute", 0, 59, nil},
+		{"hour", 0, 23, nil},
+		{"day of month", 1, 31, nil},
+		{"month", 1, 12, []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+		{"day of week", 0, 7, []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+	}
+	cronDescriptors = map[string]struct{}{
+		"@yearly": {}, "@annually": {}, "@monthly": {}, "@weekly": {},
+		"@daily": {}, "@midnight": {}, "@hourly": {},
+	}
+)
+
+// ValidateCron checks a velero schedule expression: five fields, a
+// descriptor like @daily or @every <duration>
+func ValidateCron(expr string) error {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		if _, err := time.ParseDuration(strings.TrimPrefix(expr, "@every ")); err != nil {
+			return fmt.Errorf("invalid duration in %q: %w", expr, err)
+		}
+		return nil
+	}
+	if _, ok := cronDescriptors[expr]; ok {
+		return nil
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return fmt.Errorf("expected 5 fields in %q, got %d", expr, len(fields))
+	}
+	for i, field := range fields {
+		if err := cronFields[i].validate(field); err != nil {
+			return fmt.Errorf("invalid %s in %q: %w", cronFields[i].name, expr, err)
+		}
+	}
+	return nil
+}
+
+// validate checks a comma separated list of *, values and ranges with an
+// optional /step
+func (f cronField) validate(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		rangePart := part
+		if i := strings.Index(part, "/"); i >= 0 {
+			step, err := strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			rangePart = part[:i]
+		}
+		if rangePart == "*" || rangePart == "?" {
+			continue
+		}
+		bounds := strings.SplitN(rangePart, "-", 2)
+		values := []int{}
+		for _, bound := range bounds {
+			value, err := f.value(bound)
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+		if len(values) == 2 && values[0] > values[1] {
+			return fmt.Errorf("invalid range %q", rangePart)
+		}
+	}
+	return nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("%q is not between %d and %d", s, f.min, f.max)
+	}
+	return value, nil
+}
@@ -0,0 +1,44 @@
+package watcher
+
+import (
+	"log"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// cronJobPods builds a pod from the job template of every CronJob with PVC
+// volumes, so PVCs only mounted by periodic jobs are evaluated between runs
+func (w *Watcher) cronJobPods(namespace string) []*v1.Pod {
+	cronJobs, err := w.cronJobInformer.Lister().CronJobs(namespace).List(labels.Everything())
+	if err != nil {
+		log.Printf("unable to list cronjobs: %s", err)
+		return nil
+	}
+	controller := true
+	pods := []*v1.Pod{}
+	for _, cronJob := range cronJobs {
+		template := cronJob.Spec.JobTemplate.Spec.Template
+		if !hasPVCs(&v1.Pod{Spec: template.Spec}) {
+			continue
+		}
+		pods = append(pods, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        cronJob.GetName(),
+				Namespace:   namespace,
+				Labels:      template.GetLabels(),
+				Annotations: template.GetAnnotations(),
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "batch/v1",
+					Kind:       "CronJob",
+					Name:       cronJob.GetName(),
+					UID:        cronJob.GetUID(),
+					Controller: &controller,
+				}},
+			},
+			Spec: template.Spec,
+		})
+	}
+	return pods
+}
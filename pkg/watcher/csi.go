@@ -0,0 +1,133 @@
+package watcher
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	MethodFsBackup = "fs-backup"
+	MethodCSI      = "csi"
+
+	// VeleroDeployment is the name of the velero server deployment
+	VeleroDeployment = "velero"
+)
+
+// csiEnabled detects if the velero server has CSI snapshot support, either
+// via the EnableCSI feature flag or since it is built in (velero 1.14+)
+func (v *veleroInformers) csiEnabled() bool {
+	deploy, err := v.deployLister.Deployments(v.namespace).Get(VeleroDeployment)
+	if err != nil {
+		return false
+	}
+	for _, container := range deploy.Spec.Template.Spec.Containers {
+		if container.Name != VeleroDeployment {
+			continue
+		}
+		for _, feature := range veleroFeatures(append(append([]string{}, container.Command...), container.Args...)) {
+			if feature == "EnableCSI" {
+				return true
+			}
+		}
+		if major, minor, ok := imageVersion(container.Image); ok {
+			return major > 1 || (major == 1 && minor >= 14)
+		}
+	}
+	return false
+}
+
+// snapshotDrivers lists all CSI drivers with a VolumeSnapshotClass
+func (v *veleroInformers) snapshotDrivers() map[string]struct{} {
+	drivers := map[string]struct{}{}
+	classes, err := v.vscInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return drivers
+	}
+	for _, obj := range classes {
+		if class, ok := obj.(*unstructured.Unstructured); ok {
+			if driver, ok, _ := unstructured.NestedString(class.Object, "driver"); ok {
+				drivers[driver] = struct{}{}
+			}
+		}
+	}
+	return drivers
+}
+
+// resolveMethod returns the protection path that applies to a PVC without
+// fs-backup annotation and whether a CSI snapshot covers it. A PVC with a
+// snapshot capable driver reports csi while CSI support is disabled,
+// otherwise fs-backup is the only remaining path.
+func (v *veleroInformers) resolveMethod(pvc *v1.PersistentVolumeClaim, csiEnabled bool, drivers map[string]struct{}) (string, bool) {
+	provisioner, ok := v.provisioner(pvc)
+	if !ok {
+		return MethodFsBackup, false
+	}
+	if _, ok := drivers[provisioner]; !ok {
+		return MethodFsBackup, false
+	}
+	return MethodCSI, csiEnabled
+}
+
+// provisioner returns the provisioner of the storage class of a PVC
+func (v *veleroInformers) provisioner(pvc *v1.PersistentVolumeClaim) (string, bool) {
+	if pvc.Spec.StorageClassName == nil {
+		return "", false
+	}
+	sc, err := v.scInformer.Lister().Get(*pvc.Spec.StorageClassName)
+	if err != nil {
+		return "", false
+	}
+	return sc.Provisioner, true
+}
+
+// veleroFeatures returns the feature flags of the velero server arguments,
+// given as --features=A,B or as --features A,B
+func veleroFeatures(args []string) []string {
+	features := []string{}
+	for i, arg := range args {
+		value := ""
+		switch {
+		case strings.HasPrefix(arg, "--features="):
+			value = strings.TrimPrefix(arg, "--features=")
+		case arg == "--features" && i+1 < len(args):
+			value = args[i+1]
+		default:
+			continue
+		}
+		for _, feature := range strings.Split(value, ",") {
+			if feature = strings.TrimSpace(feature); feature != "" {
+				features = append(features, feature)
+			}
+		}
+	}
+	return features
+}
+
+// imageVersion extracts major and minor from an image tag like v1.14.0,
+// a digest after the tag is ignored
+func imageVersion(image string) (int, int, bool) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(image[i+1:], "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
@@ -0,0 +1,47 @@
+package watcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVeleroFeatures(t *testing.T) {
+	tests := []struct {
+		args     []string
+		features []string
+	}{
+		{[]string{"server", "--features=EnableCSI"}, []string{"EnableCSI"}},
+		{[]string{"server", "--features=EnableAPIGroupVersions,EnableCSI"}, []string{"EnableAPIGroupVersions", "EnableCSI"}},
+		{[]string{"server", "--features", "EnableCSI", "--uploader-type=kopia"}, []string{"EnableCSI"}},
+		{[]string{"server", "--features="}, []string{}},
+		{[]string{"server", "--features"}, []string{}},
+		{[]string{"server", "--uploader-type=kopia"}, []string{}},
+	}
+	for _, test := range tests {
+		if features := veleroFeatures(test.args); !reflect.DeepEqual(features, test.features) {
+			t.Errorf("%v: got features %v, expected %v", test.args, features, test.features)
+		}
+	}
+}
+
+func TestImageVersion(t *testing.T) {
+	tests := []struct {
+		image        string
+		major, minor int
+		ok           bool
+	}{
+		{"velero/velero:v1.14.0", 1, 14, true},
+		{"velero/velero:v1.13.2", 1, 13, true},
+		{"registry.example.com:5000/velero/velero:v1.15.1", 1, 15, true},
+		{"velero/velero:v1.14.0@sha256:0123456789abcdef", 1, 14, true},
+		{"velero/velero@sha256:0123456789abcdef", 0, 0, false},
+		{"registry.example.com:5000/velero/velero", 0, 0, false},
+		{"velero/velero:latest", 0, 0, false},
+	}
+	for _, test := range tests {
+		major, minor, ok := imageVersion(test.image)
+		if major != test.major || minor != test.minor || ok != test.ok {
+			t.Errorf("%s: got %d.%d %t, expected %d.%d %t", test.image, major, minor, ok, test.major, test.minor, test.ok)
+		}
+	}
+}
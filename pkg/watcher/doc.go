@@ -0,0 +1,14 @@
+// Package watcher evaluates which PVCs of a cluster are backed up by velero
+// and exports the result as Prometheus metrics.
+//
+// Programs embedding the evaluation should only rely on Evaluator, Provider,
+// Result and Config, which stay compatible across minor releases:
+//
+//	evaluator := watcher.NewEvaluator(watcher.NewClientProvider(clientset), watcher.Config{}, stopper)
+//	for _, result := range evaluator.Evaluate("default") {
+//		fmt.Println(result.PVCName, result.State, result.Reason)
+//	}
+//
+// Everything else, like the metrics, the HTTP handlers and the optional
+// subsystems, serves the velero-pvc-watcher binary and may change.
+package watcher
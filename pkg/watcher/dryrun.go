@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// DryRunInterval is the interval the metrics are evaluated in dry-run mode
+	DryRunInterval = time.Minute
+
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeUpdated = "updated"
+)
+
+type (
+	// MetricChange is a series that would have been added, removed or
+	// updated if the metrics were exported
+	MetricChange struct {
+		Metric string            `json:"metric"`
+		Labels map[string]string `json:"labels"`
+		Change string            `json:"change"`
+		Old    *float64          `json:"old,omitempty"`
+		New    *float64          `json:"new,omitempty"`
+	}
+
+	// metricSample is the value of a single gauge or counter series
+	metricSample struct {
+		metric string
+		labels map[string]string
+		value  float64
+	}
+)
+
+// RunDryRun gathers the metrics periodically, delayed by up to jitter,
+// instead of exporting them and logs the changed series as json, histograms
+// and summaries are skipped
+func RunDryRun(gatherer prometheus.Gatherer, jitter time.Duration, stopper <-chan struct{}) {
+	ticker := time.NewTicker(DryRunInterval)
+	defer ticker.Stop()
+	delay := newJitter(jitter)
+	last := map[string]metricSample{}
+	for {
+		if !delay.wait(stopper) {
+			return
+		}
+		families, err := gatherer.Gather()
+		if err != nil {
+			log.Printf("unable to gather all metrics: %s", err)
+		}
+		current := sampleFamilies(families)
+		for _, change := range diffSamples(last, current) {
+			data, err := json.Marshal(change)
+			if err != nil {
+				log.Printf("unable to encode metric change: %s", err)
+				continue
+			}
+			log.Printf("dry-run: %s", data)
+		}
+		last = current
+		select {
+		case <-stopper:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleFamilies indexes the gauge, counter and untyped series by name and
+// labels
+func sampleFamilies(families []*dto.MetricFamily) map[string]metricSample {
+	samples := map[string]metricSample{}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			var value float64
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				value = metric.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = metric.GetCounter().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = metric.GetUntyped().GetValue()
+			default:
+				continue
+			}
+			sample := metricSample{metric: family.GetName(), labels: map[string]string{}, value: value}
+			key := []string{sample.metric}
+			for _, label := range metric.Label {
+				sample.labels[label.GetName()] = label.GetValue()
+				key = append(key, label.GetName()+"="+label.GetValue())
+			}
+			samples[strings.Join(key, ",")] = sample
+		}
+	}
+	return samples
+}
+
+// diffSamples returns the changes from the previous to the current samples
+// ordered by series
+func diffSamples(previous, current map[string]metricSample) []MetricChange {
+	keys := []string{}
+	for key := range previous {
+		keys = append(keys, key)
+	}
+	for key := range current {
+		if _, ok := previous[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	changes := []MetricChange{}
+	for _, key := range keys {
+		before, existed := previous[key]
+		after, exists := current[key]
+		switch {
+		case !existed:
+			changes = append(changes, MetricChange{
+				Metric: after.metric, Labels: after.labels, Change: ChangeAdded, New: &after.value,
+			})
+		case !exists:
+			changes = append(changes, MetricChange{
+				Metric: before.metric, Labels: before.labels, Change: ChangeRemoved, Old: &before.value,
+			})
+		case before.value != after.value:
+			changes = append(changes, MetricChange{
+				Metric: after.metric, Labels: after.labels, Change: ChangeUpdated, Old: &before.value, New: &after.value,
+			})
+		}
+	}
+	return changes
+}
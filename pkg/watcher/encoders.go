@@ -0,0 +1,275 @@
+package watcher
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+type (
+	// ReportEncoder writes evaluation and coverage reports in one format, the
+	// HTTP report endpoint, --once and the scheduled reports share them so
+	// all of them emit the same content
+	ReportEncoder interface {
+		// ContentType is the media type of the encoded reports
+		ContentType() string
+		// Extension is the file extension of the encoded reports
+		Extension() string
+		EncodeReport(out io.Writer, report Report) error
+		EncodeCoverageReport(out io.Writer, report CoverageReport) error
+	}
+
+	jsonEncoder     struct{}
+	csvEncoder      struct{}
+	markdownEncoder struct{}
+	htmlEncoder     struct{}
+)
+
+var (
+	// ReportEncoders are the report encoders by format
+	ReportEncoders = map[string]ReportEncoder{
+		FormatJSON:     jsonEncoder{},
+		FormatCSV:      csvEncoder{},
+		FormatMarkdown: markdownEncoder{},
+		FormatHTML:     htmlEncoder{},
+	}
+
+	reportColumns = []string{
+		"namespace", "pvc_name", "state", "method", "reason",
+		"storage_class", "size", "owner", "volume",
+	}
+)
+
+// NewReportEncoder returns the encoder of the format json, csv, markdown or
+// html
+func NewReportEncoder(format string) (ReportEncoder, error) {
+	encoder, ok := ReportEncoders[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown report format %q, expected %s", format, strings.Join(ReportEncoderFormats(), ", "))
+	}
+	return encoder, nil
+}
+
+// ReportEncoderFormats returns the formats of the report encoders sorted by
+// name
+func ReportEncoderFormats() []string {
+	formats := []string{}
+	for format := range ReportEncoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func (jsonEncoder) ContentType() string { return "application/json" }
+func (jsonEncoder) Extension() string   { return "json" }
+
+func (jsonEncoder) EncodeReport(out io.Writer, report Report) error {
+	return encodeJSON(out, report)
+}
+
+func (jsonEncoder) EncodeCoverageReport(out io.Writer, report CoverageReport) error {
+	return encodeJSON(out, report)
+}
+
+func encodeJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (csvEncoder) ContentType() string { return "text/csv" }
+func (csvEncoder) Extension() string   { return "csv" }
+
+// EncodeReport writes one row per PVC
+func (csvEncoder) EncodeReport(out io.Writer, report Report) error {
+	writer := csv.NewWriter(out)
+	writer.Write(reportColumns)
+	for _, entry := range report.PVCs {
+		writer.Write(reportRow(entry))
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// EncodeCoverageReport writes one row per namespace
+func (csvEncoder) EncodeCoverageReport(out io.Writer, report CoverageReport) error {
+	return writeCoverageCSV(out, report)
+}
+
+func reportRow(entry ReportEntry) []string {
+	return []string{
+		entry.Namespace,
+		entry.PVCName,
+		entry.State,
+		entry.Method,
+		entry.Reason,
+		entry.StorageClass,
+		strconv.FormatInt(entry.Size, 10),
+		entry.Owner,
+		entry.Volume,
+	}
+}
+
+func (markdownEncoder) ContentType() string { return "text/markdown; charset=utf-8" }
+func (markdownEncoder) Extension() string   { return "md" }
+
+// EncodeReport writes the totals and one table row per PVC
+func (markdownEncoder) EncodeReport(out io.Writer, report Report) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# PVC backup report %s\n\n", report.Summary.Time.UTC().Format("2006-01-02 15:04"))
+	fmt.Fprintf(b, "%d PVCs, %d missing, coverage %.1f%%\n\n",
+		report.Summary.Total, report.Summary.States[StateMissing], report.Summary.Coverage*100)
+	markdownTable(b, []string{"Namespace", "PVC", "State", "Method", "Reason", "Size", "Owner", "Volume"})
+	for _, entry := range report.PVCs {
+		markdownRow(b, entry.Namespace, entry.PVCName, entry.State, entry.Method, entry.Reason,
+			formatSize(entry.Size), orDash(entry.Owner), orDash(entry.Volume))
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// EncodeCoverageReport writes the totals, one table row per namespace and
+// the new and resolved gaps
+func (markdownEncoder) EncodeCoverageReport(out io.Writer, report CoverageReport) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# PVC backup coverage %s to %s\n\n", report.From.UTC().Format("2006-01-02"), report.To.UTC().Format("2006-01-02"))
+	fmt.Fprintf(b, "%d PVCs, coverage %.1f%% (%+.1f%%)\n\n", report.Total, report.Coverage*100, report.Delta.Coverage*100)
+	markdownTable(b, []string{"Namespace", "PVCs", "Missing", "Coverage", "Change"})
+	for _, name := range coverageNamespaces(report) {
+		ns := report.Namespaces[name]
+		markdownRow(b, name, strconv.Itoa(ns.Total), strconv.Itoa(ns.Missing),
+			fmt.Sprintf("%.1f%%", ns.Coverage*100), fmt.Sprintf("%+.1f%%", ns.Delta.Coverage*100))
+	}
+	for _, section := range []struct {
+		title string
+		gaps  []CoverageGap
+	}{
+		{"New gaps", report.NewGaps},
+		{"Resolved gaps", report.ResolvedGaps},
+	} {
+		fmt.Fprintf(b, "\n## %s\n\n", section.title)
+		if len(section.gaps) == 0 {
+			b.WriteString("none\n")
+			continue
+		}
+		for _, gap := range section.gaps {
+			fmt.Fprintf(b, "- %s/%s %s\n", markdownEscape(gap.Namespace), markdownEscape(gap.PVCName), orDash(gap.State))
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+func markdownTable(b *strings.Builder, header []string) {
+	markdownRow(b, header...)
+	separators := make([]string, len(header))
+	for i := range separators {
+		separators[i] = "---"
+	}
+	b.WriteString("| " + strings.Join(separators, " | ") + " |\n")
+}
+
+func markdownRow(b *strings.Builder, cells ...string) {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = markdownEscape(cell)
+	}
+	b.WriteString("| " + strings.Join(escaped, " | ") + " |\n")
+}
+
+// markdownEscape keeps reasons with pipes or line breaks inside their cell
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+func (htmlEncoder) ContentType() string { return "text/html; charset=utf-8" }
+func (htmlEncoder) Extension() string   { return "html" }
+
+var (
+	htmlFuncs = template.FuncMap{
+		"percent": func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+		"change":  func(f float64) string { return fmt.Sprintf("%+.1f%%", f*100) },
+		"size":    formatSize,
+		"dash":    orDash,
+	}
+
+	htmlReport = template.Must(template.New("report").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>PVC backup report</title></head>
+<body>
+<h1>PVC backup report {{.Summary.Time.UTC.Format "2006-01-02 15:04"}}</h1>
+<p>{{.Summary.Total}} PVCs, {{index .Summary.States "missing"}} missing, coverage {{percent .Summary.Coverage}}</p>
+<table>
+<tr><th>Namespace</th><th>PVC</th><th>State</th><th>Method</th><th>Reason</th><th>Size</th><th>Owner</th><th>Volume</th></tr>
+{{- range .PVCs}}
+<tr class="{{.State}}"><td>{{.Namespace}}</td><td>{{.PVCName}}</td><td>{{.State}}</td><td>{{.Method}}</td><td>{{.Reason}}</td><td>{{size .Size}}</td><td>{{dash .Owner}}</td><td>{{dash .Volume}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+	htmlCoverageReport = template.Must(template.New("coverage").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>PVC backup coverage</title></head>
+<body>
+<h1>PVC backup coverage {{.Report.From.UTC.Format "2006-01-02"}} to {{.Report.To.UTC.Format "2006-01-02"}}</h1>
+<p>{{.Report.Total}} PVCs, coverage {{percent .Report.Coverage}} ({{change .Report.Delta.Coverage}})</p>
+<table>
+<tr><th>Namespace</th><th>PVCs</th><th>Missing</th><th>Coverage</th><th>Change</th></tr>
+{{- range .Namespaces}}{{$ns := index $.Report.Namespaces .}}
+<tr><td>{{.}}</td><td>{{$ns.Total}}</td><td>{{$ns.Missing}}</td><td>{{percent $ns.Coverage}}</td><td>{{change $ns.Delta.Coverage}}</td></tr>
+{{- end}}
+</table>
+<h2>New gaps</h2>
+<ul>
+{{- range .Report.NewGaps}}
+<li>{{.Namespace}}/{{.PVCName}} {{dash .State}}</li>
+{{- else}}
+<li>none</li>
+{{- end}}
+</ul>
+<h2>Resolved gaps</h2>
+<ul>
+{{- range .Report.ResolvedGaps}}
+<li>{{.Namespace}}/{{.PVCName}} {{dash .State}}</li>
+{{- else}}
+<li>none</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+)
+
+func (htmlEncoder) EncodeReport(out io.Writer, report Report) error {
+	return htmlReport.Execute(out, report)
+}
+
+func (htmlEncoder) EncodeCoverageReport(out io.Writer, report CoverageReport) error {
+	return htmlCoverageReport.Execute(out, struct {
+		Report     CoverageReport
+		Namespaces []string
+	}{report, coverageNamespaces(report)})
+}
+
+// coverageNamespaces returns the namespaces of the report sorted by name
+func coverageNamespaces(report CoverageReport) []string {
+	names := []string{}
+	for name := range report.Namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
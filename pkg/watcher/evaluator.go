@@ -0,0 +1,67 @@
+package watcher
+
+import (
+	"time"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultResync is the resync period of informer factories created by
+	// NewClientProvider
+	DefaultResync = time.Hour
+)
+
+type (
+	// Result is the classification of a single PVC
+	Result = PVCStatus
+
+	// Evaluator classifies the PVCs of a cluster as protected, excluded or
+	// missing a backup configuration. It is the stable entry point for
+	// programs embedding the evaluation, e.g. an admission service.
+	Evaluator interface {
+		// Evaluate classifies the PVCs of a namespace
+		Evaluate(namespace string) []Result
+		// EvaluateAll classifies the PVCs of all namespaces that are not
+		// excluded by the config
+		EvaluateAll() []Result
+	}
+
+	// Provider supplies the informer factory the evaluation reads the
+	// cluster state from, so embedders can share their informer caches
+	Provider interface {
+		Factory() informers.SharedInformerFactory
+	}
+
+	factoryProvider struct {
+		factory informers.SharedInformerFactory
+	}
+)
+
+var _ Evaluator = &Watcher{}
+
+// NewFactoryProvider reads the cluster state from an existing informer
+// factory, informers the embedder registers and starts on it are shared
+func NewFactoryProvider(factory informers.SharedInformerFactory) Provider {
+	return factoryProvider{factory: factory}
+}
+
+// NewClientProvider reads the cluster state from a new informer factory of
+// the client
+func NewClientProvider(client kubernetes.Interface) Provider {
+	return factoryProvider{factory: informers.NewSharedInformerFactory(client, DefaultResync)}
+}
+
+func (p factoryProvider) Factory() informers.SharedInformerFactory {
+	return p.factory
+}
+
+// NewEvaluator registers the informers the evaluation needs in the factory
+// of the provider, starts them with factory.Start and returns once their
+// caches are synced, the informers run until stopper is closed
+func NewEvaluator(provider Provider, config Config, stopper chan struct{}) Evaluator {
+	w := NewWatcher(provider.Factory(), config)
+	w.Run(stopper)
+	return w
+}
@@ -0,0 +1,139 @@
+package watcher
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	// annotations counted on changes
+	trackedAnnotations = []string{
+		BackupAnnotation,
+		ExcludeAnnotation,
+		ExcludePVCAnnotation,
+	}
+)
+
+// registerEventHandlers adds the informer event handlers
+func (w *Watcher) registerEventHandlers() {
+	// most pods have no PVCs, their events are dropped before handling
+	w.podInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			pod, ok := unwrapTombstone(obj).(*v1.Pod)
+			return ok && hasPVCs(pod)
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldPod, ok := oldObj.(*v1.Pod)
+				newPod, ok2 := newObj.(*v1.Pod)
+				if ok && ok2 && w.countAnnotationChange("Pod", newPod.GetNamespace(), oldPod.GetAnnotations(), newPod.GetAnnotations()) {
+					w.recordAnnotationChange(newPod.GetNamespace(), claimNames(newPod)...)
+				}
+			},
+		},
+	})
+	w.pvcInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPVC, ok := oldObj.(*v1.PersistentVolumeClaim)
+			newPVC, ok2 := newObj.(*v1.PersistentVolumeClaim)
+			if ok && ok2 && w.countAnnotationChange("PersistentVolumeClaim", newPVC.GetNamespace(), oldPVC.GetAnnotations(), newPVC.GetAnnotations()) {
+				w.recordAnnotationChange(newPVC.GetNamespace(), newPVC.GetName())
+			}
+		},
+	})
+	w.pvcInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if pvc, ok := unwrapTombstone(obj).(*v1.PersistentVolumeClaim); ok {
+				w.forget(func(info PVCInfo) bool {
+					return info.Namespace == pvc.GetNamespace() && info.PVCName == pvc.GetName()
+				})
+			}
+		},
+	})
+	w.nsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if ns, ok := unwrapTombstone(obj).(*v1.Namespace); ok {
+				w.forget(func(info PVCInfo) bool {
+					return info.Namespace == ns.GetName()
+				})
+			}
+		},
+	})
+	w.stsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSts, ok := oldObj.(*appsv1.StatefulSet)
+			newSts, ok2 := newObj.(*appsv1.StatefulSet)
+			if ok && ok2 {
+				w.countAnnotationChange("StatefulSet", newSts.GetNamespace(), oldSts.Spec.Template.GetAnnotations(), newSts.Spec.Template.GetAnnotations())
+			}
+		},
+	})
+	w.deployInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldDeploy, ok := oldObj.(*appsv1.Deployment)
+			newDeploy, ok2 := newObj.(*appsv1.Deployment)
+			if ok && ok2 {
+				w.countAnnotationChange("Deployment", newDeploy.GetNamespace(), oldDeploy.Spec.Template.GetAnnotations(), newDeploy.Spec.Template.GetAnnotations())
+			}
+		},
+	})
+}
+
+// countAnnotationChange increments the change counter if any of the backup
+// annotations differs and reports whether they did
+func (w *Watcher) countAnnotationChange(kind, namespace string, oldAnnotations, newAnnotations map[string]string) bool {
+	for _, annotation := range trackedAnnotations {
+		if oldAnnotations[annotation] != newAnnotations[annotation] {
+			w.promAnnotationChanges.WithLabelValues(namespace, kind).Inc()
+			return true
+		}
+	}
+	return false
+}
+
+// unwrapTombstone extracts the last known object of a delete event, which is
+// wrapped in a DeletedFinalStateUnknown if the watch missed the deletion
+func unwrapTombstone(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
+
+// forget drops the state of all deleted PVCs matched by the filter and
+// records the removal immediately instead of on the next evaluation. Collect
+// resets all series, the cached evaluation is dropped so the next scrape does
+// not export them again. A running evaluation that listed the PVCs before
+// the deletion drops them when recording its results.
+func (w *Watcher) forget(deleted func(PVCInfo) bool) {
+	w.stateMu.Lock()
+	w.forgotten++
+	now := time.Now()
+	for info, previous := range w.lastStates {
+		if !deleted(info) {
+			continue
+		}
+		change := Change{
+			Time:      now,
+			Namespace: info.Namespace,
+			PVCName:   info.PVCName,
+			From:      previous,
+		}
+		w.changes.Add(change)
+		logChange(change, "pvc was deleted")
+		delete(w.lastStates, info)
+	}
+	for info := range w.annotationChanged {
+		if deleted(info) {
+			delete(w.annotationChanged, info)
+		}
+	}
+	w.stateMu.Unlock()
+
+	w.evaluationMu.Lock()
+	w.lastEvaluation = time.Time{}
+	w.evaluationMu.Unlock()
+}
@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FeatureCSIVerification treats PVCs of storage classes with a
+	// VolumeSnapshotClass as protected if velero supports CSI snapshots
+	FeatureCSIVerification = "CSIVerification"
+)
+
+type (
+	// FeatureGates enables or disables features by name, features that are
+	// not set use their default
+	FeatureGates map[string]bool
+)
+
+var (
+	// defaultFeatures lists all known features and their default state
+	defaultFeatures = FeatureGates{
+		FeatureCSIVerification: true,
+	}
+)
+
+// ParseFeatureGates parses a comma separated list of Name=true|false pairs
+func ParseFeatureGates(s string) (FeatureGates, error) {
+	gates := FeatureGates{}
+	if s == "" {
+		return gates, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected Name=true|false, got %q", pair)
+		}
+		if _, ok := defaultFeatures[kv[0]]; !ok {
+			return nil, fmt.Errorf("unknown feature %q, known features are %s", kv[0], strings.Join(KnownFeatures(), ", "))
+		}
+		enabled, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for feature %s: %w", kv[0], err)
+		}
+		gates[kv[0]] = enabled
+	}
+	return gates, nil
+}
+
+// KnownFeatures lists the names of all features
+func KnownFeatures() []string {
+	names := []string{}
+	for name := range defaultFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled reports whether a feature is enabled
+func (f FeatureGates) Enabled(name string) bool {
+	if enabled, ok := f[name]; ok {
+		return enabled
+	}
+	return defaultFeatures[name]
+}
+
+func (f FeatureGates) String() string {
+	parts := []string{}
+	for _, name := range KnownFeatures() {
+		parts = append(parts, fmt.Sprintf("%s=%t", name, f.Enabled(name)))
+	}
+	return strings.Join(parts, ",")
+}
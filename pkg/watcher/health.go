@@ -0,0 +1,50 @@
+package watcher
+
+import (
+	"strings"
+)
+
+// components exported by the up metric, informers are added as <name>_informer
+const (
+	ComponentEvaluator      = "evaluator"
+	ComponentAPIServer      = "apiserver"
+	ComponentConfigMap      = "configmap_publisher"
+	ComponentAdHocBackups   = "ad_hoc_backups"
+	ComponentAutoSchedules  = "auto_schedules"
+	ComponentExecHooks      = "exec_hooks"
+	ComponentOPA            = "opa"
+	ComponentReports        = "reports"
+	ComponentHistoryStore   = "history_store"
+	ComponentRemoteWrite    = "remote_write"
+	informerComponentSuffix = "_informer"
+)
+
+// setHealth records if a subsystem is working, only components that reported
+// once are exported
+func (w *Watcher) setHealth(component string, healthy bool) {
+	w.healthMu.Lock()
+	w.health[component] = healthy
+	w.healthMu.Unlock()
+}
+
+// collectHealth exports the health of every component, informers are healthy
+// once their cache synced
+func (w *Watcher) collectHealth() {
+	w.promUp.Reset()
+	for _, informer := range w.namedInformers() {
+		component := strings.ReplaceAll(informer.name, " ", "_") + informerComponentSuffix
+		w.promUp.WithLabelValues(component).Set(boolValue(informer.informer.HasSynced()))
+	}
+	w.healthMu.Lock()
+	defer w.healthMu.Unlock()
+	for component, healthy := range w.health {
+		w.promUp.WithLabelValues(component).Set(boolValue(healthy))
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
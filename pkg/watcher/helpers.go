@@ -0,0 +1,213 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	BackupAnnotation     = "backup.velero.io/backup-volumes"
+	ExcludeAnnotation    = "backup.velero.io/backup-volumes-excludes"
+	ExcludePVCAnnotation = "backup.velero.io/backup-excluded"
+
+	// EvaluateDataSourceAnnotation set to "true" evaluates a PVC provisioned
+	// from a data source like any other PVC
+	EvaluateDataSourceAnnotation = "velero-pvc-watcher/evaluate-data-source"
+)
+
+// handling is the backup handling of a PVC resolved from a pod
+type handling struct {
+	State  string
+	Reason string
+	// MissingReason is the machine readable cause of a missing PVC
+	MissingReason string
+	// Exclusion is the source of an excluded state
+	Exclusion string
+}
+
+// handlingPrecedence ranks the handlings of a PVC mounted by several pods,
+// e.g. read-write-many volumes: a backup on any pod wins, else an exclusion
+// on any pod, else the PVC is missing or unmounted
+var handlingPrecedence = map[string]int{
+	StateProtected: 0,
+	StateExcluded:  1,
+	StateUnmounted: 2,
+	StateMissing:   2,
+	StateUnmanaged: 3,
+}
+
+// setHandling stores the handling of a PVC unless a pod already resolved a
+// handling of higher or equal precedence, pods are handled sorted by name so
+// the result does not depend on the order of the cache
+func setHandling(handledPvcNames *map[string]interface{}, pvcName string, h handling) {
+	if known, ok := (*handledPvcNames)[pvcName]; ok && handlingPrecedence[known.(handling).State] <= handlingPrecedence[h.State] {
+		return
+	}
+	(*handledPvcNames)[pvcName] = h
+}
+
+// listPodHandledPVCs resolves the PVCs a pod has a backup configuration for,
+// in optOut mode all volumes that are not excluded are backed up. With
+// requireMounted, backed up volumes not mounted by any container are marked
+// unmounted since fs-backup silently skips them. With initOnlyExcluded,
+// volumes without configuration only mounted by init containers, e.g. for
+// migrations, are excluded.
+func listPodHandledPVCs(pod *v1.Pod, optOut, requireMounted, initOnlyExcluded bool, handledPvcNames *map[string]interface{}) {
+	// fetch all annotations
+	handledVolumeNames := map[string]string{}
+	if backuped, ok := pod.ObjectMeta.Annotations[BackupAnnotation]; ok {
+		volumes := strings.Split(backuped, ",")
+		for _, volume := range volumes {
+			handledVolumeNames[volume] = StateProtected
+		}
+	}
+	if excluded, ok := pod.ObjectMeta.Annotations[ExcludeAnnotation]; ok {
+		volumes := strings.Split(excluded, ",")
+		for _, volume := range volumes {
+			if _, ok := handledVolumeNames[volume]; !ok {
+				handledVolumeNames[volume] = StateExcluded
+			}
+		}
+	}
+
+	// provide map for looking up volumeName -> pvcName
+	volumeIndex := map[string]string{}
+	for _, volume := range pod.Spec.Volumes {
+		if pvcName, ok := claimName(pod, volume); ok {
+			volumeIndex[volume.Name] = pvcName
+		}
+	}
+
+	// resolve all handled pvc-names, a backup on any pod wins over an exclude
+	for volumeName, pxcName := range volumeIndex {
+		state, ok := handledVolumeNames[volumeName]
+		reason, exclusion := "", ""
+		switch {
+		case ok && state == StateProtected:
+			reason = fmt.Sprintf("pod/%s lists volume %s in %s", pod.GetName(), volumeName, BackupAnnotation)
+		case ok:
+			reason = fmt.Sprintf("pod/%s lists volume %s in %s", pod.GetName(), volumeName, ExcludeAnnotation)
+			exclusion = ExclusionPodAnnotation
+		case optOut:
+			state, ok = StateProtected, true
+			reason = fmt.Sprintf("pod/%s volume %s is backed up by an opt-out schedule", pod.GetName(), volumeName)
+		case initOnlyExcluded && isInitOnly(pod, volumeName):
+			state, ok = StateExcluded, true
+			reason = fmt.Sprintf("pod/%s mounts volume %s only in init containers", pod.GetName(), volumeName)
+		}
+		if ok && state == StateProtected && requireMounted && !isMounted(pod, volumeName) {
+			state = StateUnmounted
+			reason = fmt.Sprintf("pod/%s volume %s is not mounted by any container", pod.GetName(), volumeName)
+		}
+		if ok {
+			setHandling(handledPvcNames, pxcName, handling{State: state, Reason: reason, Exclusion: exclusion})
+		}
+	}
+}
+
+// markPodPVCs marks all PVCs of a pod with a state, without overriding PVCs
+// already protected by another pod
+func markPodPVCs(pod *v1.Pod, state, reason string, handledPvcNames *map[string]interface{}) {
+	for _, volume := range pod.Spec.Volumes {
+		pvcName, ok := claimName(pod, volume)
+		if !ok {
+			continue
+		}
+		setHandling(handledPvcNames, pvcName, handling{
+			State:  state,
+			Reason: fmt.Sprintf("pod/%s %s", pod.GetName(), reason),
+		})
+	}
+}
+
+// claimName returns the PVC backing a pod volume, the claim of a PVC volume
+// or the <pod>-<volume> PVC created for a generic ephemeral volume
+func claimName(pod *v1.Pod, volume v1.Volume) (string, bool) {
+	switch {
+	case volume.VolumeSource.PersistentVolumeClaim != nil:
+		return volume.VolumeSource.PersistentVolumeClaim.ClaimName, true
+	case volume.VolumeSource.Ephemeral != nil && pod.GetName() != "":
+		return pod.GetName() + "-" + volume.Name, true
+	}
+	return "", false
+}
+
+// hasMarker checks if any of the markers is set as annotation or label
+func hasMarker(obj metav1.Object, markers map[string]string) bool {
+	for key, value := range markers {
+		if v, ok := obj.GetAnnotations()[key]; ok && v == value {
+			return true
+		}
+		if v, ok := obj.GetLabels()[key]; ok && v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isMounted checks if any container of the pod mounts the volume, init and
+// ephemeral containers included
+func isMounted(pod *v1.Pod, volumeName string) bool {
+	return mountedBy(pod.Spec.Containers, volumeName) ||
+		mountedBy(pod.Spec.InitContainers, volumeName) ||
+		mountedByEphemeral(pod.Spec.EphemeralContainers, volumeName)
+}
+
+// isInitOnly checks if only init containers of the pod mount the volume
+func isInitOnly(pod *v1.Pod, volumeName string) bool {
+	return mountedBy(pod.Spec.InitContainers, volumeName) &&
+		!mountedBy(pod.Spec.Containers, volumeName) &&
+		!mountedByEphemeral(pod.Spec.EphemeralContainers, volumeName)
+}
+
+func mountedBy(containers []v1.Container, volumeName string) bool {
+	for _, container := range containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == volumeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func mountedByEphemeral(containers []v1.EphemeralContainer, volumeName string) bool {
+	for _, container := range containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == volumeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dataSource returns the Kind/name of the VolumeSnapshot or PVC a PVC was
+// provisioned from, unless it is annotated with EvaluateDataSourceAnnotation
+func dataSource(pvc *v1.PersistentVolumeClaim) (string, bool) {
+	if pvc.GetAnnotations()[EvaluateDataSourceAnnotation] == "true" {
+		return "", false
+	}
+	source := pvc.Spec.DataSource
+	if source == nil {
+		source = pvc.Spec.DataSourceRef
+	}
+	if source == nil {
+		return "", false
+	}
+	return source.Kind + "/" + source.Name, true
+}
+
+// pvcSize returns the actual capacity of a PVC, falling back to the request
+func pvcSize(pvc *v1.PersistentVolumeClaim) int64 {
+	if capacity, ok := pvc.Status.Capacity[v1.ResourceStorage]; ok {
+		return capacity.Value()
+	}
+	if request, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+		return request.Value()
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	HistorySize = 1024
+)
+
+type (
+	// HistoryEntry is a period of evaluations with the same totals, Delta
+	// is the change of the total and each state since the previous entry
+	HistoryEntry struct {
+		Time     time.Time      `json:"time"`
+		LastSeen time.Time      `json:"last_seen"`
+		Total    int            `json:"total"`
+		States   map[string]int `json:"states"`
+		Coverage float64        `json:"coverage"`
+		Delta    map[string]int `json:"delta"`
+		// Rollup marks a daily rollup of entries older than the raw
+		// retention, it holds the totals at the end of the day and the sum
+		// of the deltas
+		Rollup bool `json:"rollup,omitempty"`
+	}
+
+	// History is a bounded list of evaluation summaries, consecutive
+	// evaluations with equal totals are merged so the buffer covers weeks
+	// instead of hours
+	History struct {
+		mu        sync.RWMutex
+		entries   []HistoryEntry
+		size      int
+		retention time.Duration
+		// rollupRetention keeps daily rollups of the entries older than
+		// the retention, disabled if 0
+		rollupRetention time.Duration
+		// version is increased on every change to detect unsaved entries
+		version int
+	}
+)
+
+// NewHistory creates a History holding the last size entries
+func NewHistory(size int) *History {
+	return &History{
+		entries: []HistoryEntry{},
+		size:    size,
+	}
+}
+
+// Record adds the summary of an evaluation, extending the latest entry if
+// the totals did not change
+func (h *History) Record(summary Summary) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.version++
+	if len(h.entries) > 0 {
+		last := &h.entries[len(h.entries)-1]
+		if last.Total == summary.Total && equalCounts(last.States, summary.States) {
+			last.LastSeen = summary.Time
+			return
+		}
+		delta := map[string]int{"total": summary.Total - last.Total}
+		for state, count := range summary.States {
+			delta[state] = count - last.States[state]
+		}
+		for state, count := range last.States {
+			if _, ok := summary.States[state]; !ok {
+				delta[state] = -count
+			}
+		}
+		h.add(summary, delta)
+		return
+	}
+	h.add(summary, map[string]int{})
+}
+
+func (h *History) add(summary Summary, delta map[string]int) {
+	h.entries = append(h.entries, HistoryEntry{
+		Time:     summary.Time,
+		LastSeen: summary.Time,
+		Total:    summary.Total,
+		States:   summary.States,
+		Coverage: summary.Coverage,
+		Delta:    delta,
+	})
+	h.prune(summary.Time)
+}
+
+// prune drops the entries exceeding the size and the entries last seen
+// before the retention
+func (h *History) prune(now time.Time) {
+	retention := h.retention
+	if h.rollupRetention > 0 {
+		h.rollup(now.Add(-h.retention))
+		retention = h.rollupRetention
+	}
+	drop := 0
+	if h.size > 0 && len(h.entries) > h.size {
+		drop = len(h.entries) - h.size
+	}
+	if retention > 0 {
+		for drop < len(h.entries) && h.entries[drop].LastSeen.Before(now.Add(-retention)) {
+			drop++
+		}
+	}
+	if drop > 0 {
+		h.entries = append([]HistoryEntry{}, h.entries[drop:]...)
+	}
+}
+
+// rollup merges the entries last seen before cutoff into one entry per UTC
+// day, the latest entry is kept as is so evaluations can extend it
+func (h *History) rollup(cutoff time.Time) {
+	entries := []HistoryEntry{}
+	for i, entry := range h.entries {
+		if entry.Rollup || i == len(h.entries)-1 || !entry.LastSeen.Before(cutoff) {
+			entries = append(entries, entry)
+			continue
+		}
+		if n := len(entries); n > 0 && entries[n-1].Rollup && sameDay(entries[n-1].Time, entry.Time) {
+			last := &entries[n-1]
+			last.LastSeen = entry.LastSeen
+			last.Total = entry.Total
+			last.States = entry.States
+			last.Coverage = entry.Coverage
+			for state, delta := range entry.Delta {
+				last.Delta[state] += delta
+			}
+			continue
+		}
+		delta := make(map[string]int, len(entry.Delta))
+		for state, count := range entry.Delta {
+			delta[state] = count
+		}
+		entry.Delta = delta
+		entry.Rollup = true
+		entries = append(entries, entry)
+	}
+	h.entries = entries
+}
+
+func sameDay(a, b time.Time) bool {
+	a, b = a.UTC(), b.UTC()
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// Since returns all entries seen after t, oldest first
+func (h *History) Since(t time.Time) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	entries := []HistoryEntry{}
+	for _, entry := range h.entries {
+		if entry.LastSeen.After(t) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func equalCounts(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	// HistoryFlushInterval is the interval changed history entries are
+	// written to the history file
+	HistoryFlushInterval = time.Minute
+)
+
+// EnableHistoryStore loads the history from the json lines file at path and
+// writes it back every HistoryFlushInterval, so the history survives
+// restarts, e.g. on a small PVC. Entries last seen before the retention are
+// compacted into daily rollups kept for the rollup retention, or dropped if
+// it is 0, instead of the oldest entries beyond HistorySize. It has to be
+// called before Run
+func (w *Watcher) EnableHistoryStore(path string, retention, rollupRetention time.Duration, stopper <-chan struct{}) error {
+	if err := ValidateHistoryRetention(retention, rollupRetention); err != nil {
+		return err
+	}
+	entries, err := loadHistory(path)
+	if err != nil {
+		return err
+	}
+	h := w.history
+	h.mu.Lock()
+	h.entries = append(entries, h.entries...)
+	h.size = 0
+	h.retention = retention
+	h.rollupRetention = rollupRetention
+	h.prune(time.Now())
+	h.mu.Unlock()
+	log.Printf("loaded %d history entries from %s", len(entries), path)
+
+	go func() {
+		ticker := time.NewTicker(HistoryFlushInterval)
+		defer ticker.Stop()
+		saved := -1
+		for {
+			select {
+			case <-stopper:
+				return
+			case <-ticker.C:
+			}
+			// compact even if no evaluation added an entry
+			h.mu.Lock()
+			before := len(h.entries)
+			h.prune(time.Now())
+			if len(h.entries) != before {
+				h.version++
+			}
+			version := h.version
+			entries := append([]HistoryEntry{}, h.entries...)
+			h.mu.Unlock()
+			if version == saved {
+				continue
+			}
+			if err := saveHistory(path, entries); err != nil {
+				log.Printf("unable to write history to %s: %s", path, err)
+				w.setHealth(ComponentHistoryStore, false)
+				continue
+			}
+			w.setHealth(ComponentHistoryStore, true)
+			saved = version
+		}
+	}()
+	return nil
+}
+
+// ValidateHistoryRetention checks that the retention is positive and the
+// rollup retention 0 or longer than the retention
+func ValidateHistoryRetention(retention, rollupRetention time.Duration) error {
+	if retention <= 0 {
+		return fmt.Errorf("retention has to be positive, got %s", retention)
+	}
+	if rollupRetention != 0 && rollupRetention <= retention {
+		return fmt.Errorf("rollup retention %s has to exceed the retention %s", rollupRetention, retention)
+	}
+	return nil
+}
+
+// loadHistory reads one entry per line, a missing file is an empty history
+// and lines that can not be decoded, e.g. after a crash while writing, are
+// skipped
+func loadHistory(path string) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		entry := HistoryEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("skipping invalid history entry in %s line %d: %s", path, line, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// saveHistory replaces the file atomically so a crash leaves either the
+// previous or the new history
+func saveHistory(path string, entries []HistoryEntry) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,123 @@
+package watcher
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	HookEventUnprotected = "unprotected"
+	HookEventProtected   = "protected"
+
+	// HookTimeout limits the runtime of a single hook execution
+	HookTimeout = 30 * time.Second
+	// HookQueueSize is the number of events buffered while a hook runs,
+	// further events are dropped
+	HookQueueSize = 256
+)
+
+type (
+	// HookEvent is passed to the hook command as VELERO_PVC_WATCHER_*
+	// environment variables
+	HookEvent struct {
+		Event string
+		Change
+	}
+
+	// execHooks runs a command whenever a PVC becomes unprotected or
+	// protected again
+	execHooks struct {
+		watcher *Watcher
+		command []string
+		events  chan HookEvent
+
+		mu     sync.Mutex
+		states map[PVCInfo]string
+	}
+)
+
+// EnableExecHooks runs the command with its arguments for every PVC that
+// becomes missing or changes from missing to protected or excluded, it has
+// to be called before Run. The changes are detected off the evaluation path
+// and queued for the hook runner, slow or failing hooks never delay a scrape.
+func (w *Watcher) EnableExecHooks(command []string) {
+	h := &execHooks{
+		watcher: w,
+		command: command,
+		events:  make(chan HookEvent, HookQueueSize),
+	}
+	go h.run()
+	w.OnEvaluationAsync(h.observe)
+}
+
+func (h *execHooks) observe(statuses []PVCStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	states := map[PVCInfo]string{}
+	for _, status := range statuses {
+		states[status.PVCInfo] = status.State
+		// the first evaluation only records the initial states
+		if h.states == nil {
+			continue
+		}
+		previous, ok := h.states[status.PVCInfo]
+		event := ""
+		switch {
+		case status.State == StateMissing && previous != StateMissing:
+			event = HookEventUnprotected
+		case ok && previous == StateMissing && (status.State == StateProtected || status.State == StateExcluded):
+			event = HookEventProtected
+		default:
+			continue
+		}
+		select {
+		case h.events <- HookEvent{Event: event, Change: Change{
+			Time:      now,
+			Namespace: status.Namespace,
+			PVCName:   status.PVCName,
+			From:      previous,
+			To:        status.State,
+		}}:
+		default:
+			log.Printf("hook queue is full, dropping %s event of %s/%s", event, status.Namespace, status.PVCName)
+		}
+	}
+	h.states = states
+}
+
+func (h *execHooks) run() {
+	for event := range h.events {
+		if err := h.exec(event); err != nil {
+			log.Printf("hook for %s event of %s/%s failed: %s", event.Event, event.Namespace, event.PVCName, err)
+			h.watcher.setHealth(ComponentExecHooks, false)
+			continue
+		}
+		h.watcher.setHealth(ComponentExecHooks, true)
+	}
+}
+
+func (h *execHooks) exec(event HookEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), HookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"VELERO_PVC_WATCHER_EVENT="+event.Event,
+		"VELERO_PVC_WATCHER_NAMESPACE="+event.Namespace,
+		"VELERO_PVC_WATCHER_PVC_NAME="+event.PVCName,
+		"VELERO_PVC_WATCHER_FROM="+event.From,
+		"VELERO_PVC_WATCHER_TO="+event.To,
+		"VELERO_PVC_WATCHER_TIME="+event.Time.Format(time.RFC3339),
+	)
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		log.Printf("hook output for %s/%s: %s", event.Namespace, event.PVCName, output)
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package watcher
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// PodPVCIndex indexes pods by namespace/claimName of their PVC volumes
+	PodPVCIndex = "pvc"
+)
+
+// indexPodByPVC returns the namespace/claimName keys of all PVCs of a pod
+func indexPodByPVC(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	keys := []string{}
+	for _, volume := range pod.Spec.Volumes {
+		if pvcName, ok := claimName(pod, volume); ok {
+			keys = append(keys, pod.GetNamespace()+"/"+pvcName)
+		}
+	}
+	return keys, nil
+}
+
+// podsForPVCs looks up all pods referencing any of the PVCs
+func (w *Watcher) podsForPVCs(namespace string, pvcList []*v1.PersistentVolumeClaim) ([]*v1.Pod, error) {
+	indexer := w.podInformer.Informer().GetIndexer()
+	seen := map[string]struct{}{}
+	pods := []*v1.Pod{}
+	for _, pvc := range pvcList {
+		objs, err := indexer.ByIndex(PodPVCIndex, namespace+"/"+pvc.GetName())
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			pod, ok := obj.(*v1.Pod)
+			if !ok {
+				continue
+			}
+			if _, ok := seen[string(pod.GetUID())]; ok {
+				continue
+			}
+			seen[string(pod.GetUID())] = struct{}{}
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
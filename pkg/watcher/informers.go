@@ -0,0 +1,114 @@
+package watcher
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// WarmUpLogInterval is the interval the progress of the initial sync is
+	// logged at
+	WarmUpLogInterval = 10 * time.Second
+)
+
+// warmUp waits for the initial sync of the informers and logs the progress:
+// every synced resource with its object count and periodically the pending
+// ones with an estimate of the remaining time. backupmonitor_warming_up is 1
+// meanwhile, so a slow warm-up is distinguishable from a hung exporter.
+func (w *Watcher) warmUp(named []namedInformer, stopper chan struct{}) {
+	w.promWarmingUp.Set(1)
+	defer w.promWarmingUp.Set(0)
+
+	start := time.Now()
+	pending := map[string]namedInformer{}
+	for _, informer := range named {
+		pending[informer.name] = informer
+	}
+	synced := make(chan string, len(named))
+	for _, informer := range named {
+		go func(informer namedInformer) {
+			if cache.WaitForCacheSync(stopper, informer.informer.HasSynced) {
+				synced <- informer.name
+			}
+		}(informer)
+	}
+	progress := time.NewTicker(WarmUpLogInterval)
+	defer progress.Stop()
+	for len(pending) > 0 {
+		select {
+		case <-stopper:
+			log.Printf("warm-up aborted, %d informers not synced", len(pending))
+			return
+		case <-progress.C:
+			logWarmUpProgress(start, len(named), pending)
+		case name := <-synced:
+			informer := pending[name]
+			delete(pending, name)
+			w.markActivity(name)
+			log.Printf("warm-up synced informer=%s objects=%d elapsed=%s", name,
+				len(informer.informer.GetStore().ListKeys()), time.Since(start).Round(time.Second))
+		}
+	}
+	log.Printf("warm-up done informers=%d elapsed=%s", len(named), time.Since(start).Round(time.Second))
+}
+
+// logWarmUpProgress logs the pending informers with the objects listed so
+// far, the remaining time is estimated from the time the synced ones took
+func logWarmUpProgress(start time.Time, total int, pending map[string]namedInformer) {
+	elapsed := time.Since(start)
+	synced := total - len(pending)
+	eta := "unknown"
+	if synced > 0 {
+		eta = (elapsed * time.Duration(len(pending)) / time.Duration(synced)).Round(time.Second).String()
+	}
+	names := []string{}
+	for name := range pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	objects := []string{}
+	for _, name := range names {
+		objects = append(objects, name+":"+strconv.Itoa(len(pending[name].informer.GetStore().ListKeys())))
+	}
+	log.Printf("warming up synced=%d/%d pending=%s elapsed=%s eta=%s", synced, total,
+		strings.Join(objects, ","), elapsed.Round(time.Second), eta)
+}
+
+// trackActivity records the time of every event of the informer, with the
+// hourly resync a healthy watch never goes silent for much longer
+func (w *Watcher) trackActivity(informer namedInformer) {
+	informer.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { w.markActivity(informer.name) },
+		UpdateFunc: func(interface{}, interface{}) { w.markActivity(informer.name) },
+		DeleteFunc: func(interface{}) { w.markActivity(informer.name) },
+	})
+}
+
+func (w *Watcher) markActivity(name string) {
+	w.activityMu.Lock()
+	w.informerActivity[name] = time.Now()
+	w.activityMu.Unlock()
+}
+
+// collectInformers exports the cache size and activity of all informers
+func (w *Watcher) collectInformers(ch chan<- prometheus.Metric) {
+	w.promInformerObjects.Reset()
+	w.promInformerLastSync.Reset()
+	w.activityMu.Lock()
+	defer w.activityMu.Unlock()
+	for _, informer := range w.namedInformers() {
+		w.promInformerObjects.WithLabelValues(informer.name).Set(float64(len(informer.informer.GetStore().ListKeys())))
+		if t, ok := w.informerActivity[informer.name]; ok {
+			w.promInformerLastSync.WithLabelValues(informer.name).Set(float64(t.Unix()))
+		}
+	}
+	w.promInformerObjects.Collect(ch)
+	w.promInformerLastSync.Collect(ch)
+}
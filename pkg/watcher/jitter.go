@@ -0,0 +1,35 @@
+package watcher
+
+import (
+	"math/rand"
+	"time"
+)
+
+// jitter delays periodic evaluations by a random duration up to max, so
+// replicas started together do not evaluate in lockstep
+type jitter struct {
+	max    time.Duration
+	random *rand.Rand
+}
+
+func newJitter(max time.Duration) *jitter {
+	return &jitter{
+		max:    max,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// wait sleeps the random delay, false if stopped meanwhile
+func (j *jitter) wait(stopper <-chan struct{}) bool {
+	if j.max <= 0 {
+		return true
+	}
+	timer := time.NewTimer(time.Duration(j.random.Int63n(int64(j.max))))
+	defer timer.Stop()
+	select {
+	case <-stopper:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// BackupPhaseCompleted is the phase of a velero backup that finished
+	// without errors
+	BackupPhaseCompleted = "Completed"
+	// BackupPhaseInProgress and the BackupPhaseWaitingForPluginOperations
+	// phases are the phases of a velero backup with running item operations
+	BackupPhaseInProgress                                = "InProgress"
+	BackupPhaseWaitingForPluginOperations                = "WaitingForPluginOperations"
+	BackupPhaseWaitingForPluginOperationsPartiallyFailed = "WaitingForPluginOperationsPartiallyFailed"
+
+	// BackupScheduleLabel names the schedule that created a velero backup
+	BackupScheduleLabel = "velero.io/schedule-name"
+)
+
+// listBackups lists all velero backups
+func (v *veleroInformers) listBackups() []*unstructured.Unstructured {
+	backups := []*unstructured.Unstructured{}
+	objs, err := v.backupInformer.Lister().ByNamespace(v.namespace).List(labels.Everything())
+	if err != nil {
+		return backups
+	}
+	for _, obj := range objs {
+		if backup, ok := obj.(*unstructured.Unstructured); ok {
+			backups = append(backups, backup)
+		}
+	}
+	return backups
+}
+
+// backupCompletion is the most recent completed backup of a namespace
+type backupCompletion struct {
+	name string
+	time time.Time
+}
+
+// lastCompletions returns the most recent completed backup covering each of
+// the namespaces
+func (v *veleroInformers) lastCompletions(namespaces map[string]bool) map[string]backupCompletion {
+	latest := map[string]backupCompletion{}
+	for _, backup := range v.listBackups() {
+		phase, _, _ := unstructured.NestedString(backup.Object, "status", "phase")
+		if phase != BackupPhaseCompleted {
+			continue
+		}
+		raw, _, _ := unstructured.NestedString(backup.Object, "status", "completionTimestamp")
+		completed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			continue
+		}
+		for namespace := range namespaces {
+			if !specCovers(backup, namespace, "spec") {
+				continue
+			}
+			if last, ok := latest[namespace]; ok && !completed.After(last.time) {
+				continue
+			}
+			latest[namespace] = backupCompletion{name: backup.GetName(), time: completed}
+		}
+	}
+	return latest
+}
+
+// lastBackups returns the name of the most recent completed backup covering
+// each of the namespaces
+func (v *veleroInformers) lastBackups(namespaces map[string]bool) map[string]string {
+	latest := v.lastCompletions(namespaces)
+	names := make(map[string]string, len(latest))
+	for namespace, last := range latest {
+		names[namespace] = last.name
+	}
+	return names
+}
+
+// markStaleBackups marks the protected PVCs of a namespace as at risk if no
+// velero backup covering the namespace completed within
+// Config.StaleBackupAge, namespaces younger than the age are skipped while
+// they have no backup
+func (w *Watcher) markStaleBackups(namespace string, statuses []PVCStatus) {
+	protected := false
+	for _, status := range statuses {
+		if status.State == StateProtected {
+			protected = true
+			break
+		}
+	}
+	if !protected {
+		return
+	}
+	now := time.Now()
+	reason := ""
+	if last, ok := w.velero.lastCompletions(map[string]bool{namespace: true})[namespace]; ok {
+		if now.Sub(last.time) <= w.config.StaleBackupAge {
+			return
+		}
+		reason = fmt.Sprintf("the last completed backup %s finished at %s", last.name, last.time.Format(time.RFC3339))
+	} else {
+		ns, err := w.nsInformer.Lister().Get(namespace)
+		if err != nil || now.Sub(ns.GetCreationTimestamp().Time) <= w.config.StaleBackupAge {
+			return
+		}
+		reason = "no backup covering the namespace completed"
+	}
+	for i := range statuses {
+		if statuses[i].State != StateProtected {
+			continue
+		}
+		statuses[i].MissingReason = ReasonStaleBackup
+		statuses[i].Reason += ", but " + reason
+	}
+}
+
+// collectLastBackups exports the most recent completed backup of the
+// namespace of each protected PVC
+func (v *veleroInformers) collectLastBackups(statuses []PVCStatus) {
+	v.promLastBackup.Reset()
+
+	namespaces := map[string]bool{}
+	for _, status := range statuses {
+		if status.State == StateProtected {
+			namespaces[status.Namespace] = true
+		}
+	}
+	if len(namespaces) == 0 {
+		return
+	}
+	backups := v.lastBackups(namespaces)
+	for _, status := range statuses {
+		if status.State != StateProtected {
+			continue
+		}
+		backup, ok := backups[status.Namespace]
+		if !ok {
+			continue
+		}
+		v.promLastBackup.WithLabelValues(status.Namespace, status.PVCName, backup).Set(1)
+	}
+}
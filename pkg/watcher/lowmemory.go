@@ -0,0 +1,88 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	LastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// useLowMemoryPodInformer registers a pod informer in the factory that only
+// caches the fields needed for evaluation. Pods dominate the memory usage of
+// the watcher on large clusters, so managed fields, status and everything
+// but the volumes and mounts of the containers are dropped before caching.
+func useLowMemoryPodInformer(factory informers.SharedInformerFactory) {
+	factory.InformerFor(&v1.Pod{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(
+			&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					list, err := client.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), options)
+					if err != nil {
+						return nil, err
+					}
+					for i := range list.Items {
+						stripPod(&list.Items[i])
+					}
+					return list, nil
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					w, err := client.CoreV1().Pods(metav1.NamespaceAll).Watch(context.TODO(), options)
+					if err != nil {
+						return nil, err
+					}
+					return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+						if pod, ok := event.Object.(*v1.Pod); ok {
+							stripPod(pod)
+						}
+						return event, true
+					}), nil
+				},
+			},
+			&v1.Pod{},
+			resync,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+	})
+}
+
+// stripPod drops all fields not used for evaluation
+func stripPod(pod *v1.Pod) {
+	pod.ObjectMeta.ManagedFields = nil
+	delete(pod.ObjectMeta.Annotations, LastAppliedAnnotation)
+	pod.Status = v1.PodStatus{}
+	pod.Spec.Containers = stripContainers(pod.Spec.Containers)
+	pod.Spec.InitContainers = stripContainers(pod.Spec.InitContainers)
+	for i, container := range pod.Spec.EphemeralContainers {
+		pod.Spec.EphemeralContainers[i] = v1.EphemeralContainer{
+			EphemeralContainerCommon: v1.EphemeralContainerCommon{
+				Name:         container.Name,
+				VolumeMounts: container.VolumeMounts,
+			},
+		}
+	}
+	pod.Spec.Affinity = nil
+	pod.Spec.Tolerations = nil
+	pod.Spec.TopologySpreadConstraints = nil
+}
+
+func stripContainers(containers []v1.Container) []v1.Container {
+	stripped := make([]v1.Container, 0, len(containers))
+	for _, container := range containers {
+		stripped = append(stripped, v1.Container{
+			Name:         container.Name,
+			Image:        container.Image,
+			VolumeMounts: container.VolumeMounts,
+		})
+	}
+	return stripped
+}
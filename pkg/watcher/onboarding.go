@@ -0,0 +1,86 @@
+package watcher
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	OnboardingNoProtectedPVCs = "no_protected_pvcs"
+	OnboardingNoSchedule      = "no_schedule"
+)
+
+// collectOnboarding flags namespaces created within the onboarding window
+// that got PVCs but no backup after the grace period: none of their PVCs
+// is protected, or with velero CRDs no schedule covers them. Each flagged
+// namespace is logged once.
+func (w *Watcher) collectOnboarding(statuses []PVCStatus) {
+	w.promNotOnboarded.Reset()
+	if w.config.OnboardingWindow <= 0 {
+		return
+	}
+	type counts struct{ protected, missing int }
+	byNamespace := map[string]*counts{}
+	for _, status := range statuses {
+		c, ok := byNamespace[status.Namespace]
+		if !ok {
+			c = &counts{}
+			byNamespace[status.Namespace] = c
+		}
+		switch status.State {
+		case StateProtected:
+			c.protected++
+		case StateMissing:
+			c.missing++
+		}
+	}
+
+	now := time.Now()
+	flagged := map[string]bool{}
+	for namespace, c := range byNamespace {
+		ns, err := w.nsInformer.Lister().Get(namespace)
+		if err != nil {
+			continue
+		}
+		age := now.Sub(ns.GetCreationTimestamp().Time)
+		if age < w.config.OnboardingGrace || age > w.config.OnboardingWindow {
+			continue
+		}
+		reason := ""
+		switch {
+		case c.missing > 0 && c.protected == 0:
+			reason = OnboardingNoProtectedPVCs
+		case c.protected > 0 && w.velero != nil && !w.velero.scheduled(namespace):
+			reason = OnboardingNoSchedule
+		default:
+			continue
+		}
+		w.promNotOnboarded.WithLabelValues(namespace, reason).Set(1)
+		flagged[namespace] = true
+		w.stateMu.Lock()
+		logged := w.onboardingLogged[namespace]
+		w.onboardingLogged[namespace] = true
+		w.stateMu.Unlock()
+		if !logged {
+			log.Printf("namespace %s created %s ago has PVCs but is not onboarded to backups: %s", namespace, age.Round(time.Minute), reason)
+		}
+	}
+	// log namespaces again if they regress after being onboarded
+	w.stateMu.Lock()
+	for namespace := range w.onboardingLogged {
+		if !flagged[namespace] {
+			delete(w.onboardingLogged, namespace)
+		}
+	}
+	w.stateMu.Unlock()
+}
+
+// scheduled checks if any schedule covers the namespace
+func (v *veleroInformers) scheduled(namespace string) bool {
+	for _, schedule := range v.listSchedules() {
+		if scheduleCovers(schedule, namespace) {
+			return true
+		}
+	}
+	return false
+}
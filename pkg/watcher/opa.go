@@ -0,0 +1,115 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+const (
+	// OPAQuery is the default query of the policy decisions
+	OPAQuery = "data.backup.classify"
+	// OPATimeout limits the evaluation of the policy for a single namespace
+	OPATimeout = 5 * time.Second
+)
+
+// opaPolicy lets Rego policies decide the state of PVCs, so existing OPA
+// policy libraries can be reused, the policies are evaluated in-process
+type opaPolicy struct {
+	watcher *Watcher
+	query   rego.PreparedEvalQuery
+}
+
+// EnableOPA loads the Rego policies of the files and directories in paths
+// and evaluates the query, e.g. data.backup.classify, once per namespace
+// and evaluation, it has to be called before Run
+func (w *Watcher) EnableOPA(paths []string, query string) error {
+	if len(w.config.Rules) > 0 {
+		return fmt.Errorf("opa policies can not be combined with rules")
+	}
+	prepared, err := prepareOPAQuery(paths, query)
+	if err != nil {
+		return err
+	}
+	w.opa = &opaPolicy{
+		watcher: w,
+		query:   prepared,
+	}
+	return nil
+}
+
+// ValidateOPAPolicy checks that the Rego policies of the files and
+// directories in paths load and compile with the query
+func ValidateOPAPolicy(paths []string, query string) error {
+	_, err := prepareOPAQuery(paths, query)
+	return err
+}
+
+func prepareOPAQuery(paths []string, query string) (rego.PreparedEvalQuery, error) {
+	if len(paths) == 0 {
+		return rego.PreparedEvalQuery{}, fmt.Errorf("no policy files given")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), OPATimeout)
+	defer cancel()
+	return rego.New(rego.Query(query), rego.Load(paths, nil)).PrepareForEval(ctx)
+}
+
+// apply overrides the states of the statuses with the decisions of the
+// policy, the inputs are the rule variables of each status in the same
+// order, PVCs the policy has no decision for keep their state
+func (o *opaPolicy) apply(namespace string, statuses []PVCStatus, inputs []map[string]interface{}) {
+	if len(statuses) == 0 {
+		return
+	}
+	decisions, err := o.decide(namespace, inputs)
+	if err != nil {
+		log.Printf("unable to evaluate opa policy for namespace %s: %s", namespace, err)
+		o.watcher.setHealth(ComponentOPA, false)
+		return
+	}
+	o.watcher.setHealth(ComponentOPA, true)
+	for i := range statuses {
+		decision, ok := decisions[statuses[i].PVCName]
+		if !ok {
+			continue
+		}
+		switch state, _ := decision.(string); state {
+		case StateProtected, StateExcluded, StateMissing:
+			statuses[i].State = state
+			statuses[i].Reason = "opa policy decided " + state
+			statuses[i].MissingReason = ""
+			statuses[i].Exclusion = ""
+			if state == StateMissing {
+				statuses[i].MissingReason = ReasonPolicy
+			}
+		default:
+			log.Printf("ignoring invalid opa decision %v for %s/%s", decision, namespace, statuses[i].PVCName)
+		}
+	}
+}
+
+// decide evaluates the query with the PVCs of a namespace as input and
+// expects an object mapping PVC names to states as result, an undefined
+// result decides nothing
+func (o *opaPolicy) decide(namespace string, inputs []map[string]interface{}) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), OPATimeout)
+	defer cancel()
+	results, err := o.query.Eval(ctx, rego.EvalInput(map[string]interface{}{
+		"namespace": namespace,
+		"pvcs":      inputs,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return nil, nil
+	}
+	decisions, ok := results[0].Expressions[0].Value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object mapping pvc names to states, got %T", results[0].Expressions[0].Value)
+	}
+	return decisions, nil
+}
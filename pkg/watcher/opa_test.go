@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPolicy = `package backup
+
+classify[name] = "excluded" {
+  some i
+  input.pvcs[i].pvc.labels.tier == "cache"
+  name := input.pvcs[i].pvc.name
+}
+
+classify[name] = "missing" {
+  some i
+  input.pvcs[i].pvc.size > 100
+  name := input.pvcs[i].pvc.name
+}
+`
+
+func TestOPAPolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backup.rego")
+	if err := os.WriteFile(path, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w := &Watcher{health: map[string]bool{}}
+	if err := w.EnableOPA([]string{dir}, OPAQuery); err != nil {
+		t.Fatalf("EnableOPA: %s", err)
+	}
+
+	pvc := func(name, tier string, size int64) map[string]interface{} {
+		return map[string]interface{}{"pvc": map[string]interface{}{
+			"name":   name,
+			"labels": map[string]interface{}{"tier": tier},
+			"size":   size,
+		}}
+	}
+	statuses := []PVCStatus{
+		{PVCInfo: PVCInfo{PVCName: "cache"}, State: StateMissing, MissingReason: ReasonNoAnnotation},
+		{PVCInfo: PVCInfo{PVCName: "large"}, State: StateProtected},
+		{PVCInfo: PVCInfo{PVCName: "data"}, State: StateProtected},
+	}
+	w.opa.apply("shop", statuses, []map[string]interface{}{
+		pvc("cache", "cache", 1),
+		pvc("large", "db", 1000),
+		pvc("data", "db", 1),
+	})
+	expected := []struct{ state, missingReason string }{
+		{StateExcluded, ""},
+		{StateMissing, ReasonPolicy},
+		{StateProtected, ""},
+	}
+	for i, status := range statuses {
+		if status.State != expected[i].state || status.MissingReason != expected[i].missingReason {
+			t.Errorf("%s resulted in %s/%q, expected %s/%q", status.PVCName, status.State, status.MissingReason, expected[i].state, expected[i].missingReason)
+		}
+	}
+}
+
+func TestValidateOPAPolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "invalid.rego")
+	if err := os.WriteFile(path, []byte("package backup\n\nclassify[name] {"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateOPAPolicy([]string{path}, OPAQuery); err == nil {
+		t.Error("expected an error for an invalid policy")
+	}
+	if err := ValidateOPAPolicy([]string{filepath.Join(dir, "missing.rego")}, OPAQuery); err == nil {
+		t.Error("expected an error for a missing policy file")
+	}
+}
@@ -0,0 +1,253 @@
+package watcher
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type (
+	// apiOperation documents a GET endpoint of the HTTP API
+	apiOperation struct {
+		path        string
+		summary     string
+		parameters  []interface{}
+		response    interface{}
+		contentType string
+		// alternatives are further media types selected by the format
+		// parameter
+		alternatives []string
+		// ready marks endpoints answering with 503 until the first
+		// evaluation completed
+		ready bool
+		auth  bool
+	}
+)
+
+var (
+	sinceParameter = map[string]interface{}{
+		"name":        "since",
+		"in":          "query",
+		"description": "only return entries after the timestamp",
+		"schema":      map[string]interface{}{"type": "string", "format": "date-time"},
+	}
+
+	// apiOperations lists the endpoints of the api group, the response
+	// schemas are generated from the response types
+	apiOperations = []apiOperation{
+		{
+			path:       "/api/v1/changes",
+			summary:    "protection state changes of PVCs",
+			parameters: []interface{}{sinceParameter},
+			response:   []Change{},
+			ready:      true,
+		},
+		{
+			path:       "/api/v1/history",
+			summary:    "evaluation summaries, consecutive evaluations with equal totals are merged",
+			parameters: []interface{}{sinceParameter},
+			response:   []HistoryEntry{},
+			ready:      true,
+		},
+		{
+			path:    "/api/v1/report",
+			summary: "classification of all PVCs of the latest evaluation",
+			parameters: []interface{}{map[string]interface{}{
+				"name": "format",
+				"in":   "query",
+				"schema": map[string]interface{}{
+					"type":    "string",
+					"enum":    ReportEncoderFormats(),
+					"default": FormatJSON,
+				},
+			}},
+			response:     Report{},
+			alternatives: []string{"text/csv", "text/markdown", "text/html"},
+			ready:        true,
+		},
+		{
+			path:     "/api/v1/remediations",
+			summary:  "patches adding the volumes of missing PVCs to the backup annotation of their workloads",
+			response: []Remediation{},
+			ready:    true,
+		},
+		{
+			path:    "/api/v1/policy",
+			summary: "admission policy equivalent to the configuration",
+			parameters: []interface{}{map[string]interface{}{
+				"name":     "format",
+				"in":       "query",
+				"required": true,
+				"schema": map[string]interface{}{
+					"type": "string",
+					"enum": []string{PolicyGatekeeper, PolicyKyverno},
+				},
+			}},
+			contentType: "application/yaml",
+		},
+		{
+			path:     "/api/v1/config",
+			summary:  "effective configuration in the config file format, secrets are redacted",
+			response: map[string]interface{}{},
+		},
+		{
+			path:     "/api/v1/cardinality",
+			summary:  "series exported per metric and namespace",
+			response: Cardinality{},
+			ready:    true,
+		},
+		{
+			path:     "/debug/state",
+			summary:  "evaluated pods per namespace, the categorization of their volumes and the reason of each PVC classification, served if --debug-token is set",
+			response: []NamespaceDebug{},
+			ready:    true,
+			auth:     true,
+		},
+	}
+)
+
+// OpenAPI returns the OpenAPI 3 document of the HTTP API
+func OpenAPI(version string) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations {
+		responses := map[string]interface{}{
+			"200": apiResponse(op, schemas),
+		}
+		if len(op.parameters) > 0 {
+			responses["400"] = map[string]interface{}{"description": "invalid parameter"}
+		}
+		if op.ready {
+			responses["503"] = map[string]interface{}{"description": "waiting for the first evaluation"}
+		}
+		get := map[string]interface{}{
+			"summary":   op.summary,
+			"responses": responses,
+		}
+		if len(op.parameters) > 0 {
+			get["parameters"] = op.parameters
+		}
+		if op.auth {
+			get["security"] = []interface{}{map[string]interface{}{"debugToken": []string{}}}
+			responses["401"] = map[string]interface{}{"description": "missing or wrong bearer token"}
+		}
+		paths[op.path] = map[string]interface{}{"get": get}
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "velero-pvc-watcher",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"debugToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// OpenAPIHandler serves the OpenAPI document as json
+func OpenAPIHandler(version string) http.HandlerFunc {
+	document := OpenAPI(version)
+	return func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, document)
+	}
+}
+
+func apiResponse(op apiOperation, schemas map[string]interface{}) map[string]interface{} {
+	response := map[string]interface{}{"description": op.summary}
+	if op.contentType != "" {
+		response["content"] = map[string]interface{}{
+			op.contentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+		}
+		return response
+	}
+	content := map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": schemaOf(reflect.TypeOf(op.response), schemas),
+		},
+	}
+	for _, contentType := range op.alternatives {
+		content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	}
+	response["content"] = content
+	return response
+}
+
+// schemaOf derives the json schema of a type from its json tags, named
+// structs are added to the schemas and referenced
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]interface{}{"type": "object"}
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+		// reserve the name first for recursive types
+		schemas[t.Name()] = nil
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name, omitempty := jsonName(field)
+			if name == "-" {
+				continue
+			}
+			properties[name] = schemaOf(field.Type, schemas)
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[t.Name()] = schema
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// jsonName returns the name encoding/json uses for a field and if it is
+// omitted when empty
+func jsonName(field reflect.StructField) (string, bool) {
+	parts := strings.Split(field.Tag.Get("json"), ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
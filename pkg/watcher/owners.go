@@ -0,0 +1,203 @@
+package watcher
+
+import (
+	"log"
+	"sort"
+	"strconv"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// ExcludeFromBackupLabel makes velero skip the labeled resource
+	ExcludeFromBackupLabel = "velero.io/exclude-from-backup"
+	// DeploymentRevisionAnnotation is the revision of the Deployment a
+	// ReplicaSet was created for
+	DeploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+)
+
+// isExcludedFromBackup checks if the pod or one of its controllers carries
+// the velero exclude-from-backup label
+func (w *Watcher) isExcludedFromBackup(pod *v1.Pod) bool {
+	if hasExcludeLabel(pod) {
+		return true
+	}
+	namespace := pod.GetNamespace()
+	for _, owner := range pod.GetOwnerReferences() {
+		switch owner.Kind {
+		case "StatefulSet":
+			sts, err := w.stsInformer.Lister().StatefulSets(namespace).Get(owner.Name)
+			if err == nil && hasExcludeLabel(sts) {
+				return true
+			}
+		case "CronJob":
+			if w.cronJobInformer == nil {
+				continue
+			}
+			cronJob, err := w.cronJobInformer.Lister().CronJobs(namespace).Get(owner.Name)
+			if err == nil && hasExcludeLabel(cronJob) {
+				return true
+			}
+		case "ReplicaSet":
+			rs, err := w.rsInformer.Lister().ReplicaSets(namespace).Get(owner.Name)
+			if err != nil {
+				continue
+			}
+			if hasExcludeLabel(rs) {
+				return true
+			}
+			for _, rsOwner := range rs.GetOwnerReferences() {
+				if rsOwner.Kind != "Deployment" {
+					continue
+				}
+				deploy, err := w.deployInformer.Lister().Deployments(namespace).Get(rsOwner.Name)
+				if err == nil && hasExcludeLabel(deploy) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// topOwnerKind resolves the kind of the top level controller of a pod,
+// following ReplicaSets to their Deployment. Bare pods are of kind Pod.
+func (w *Watcher) topOwnerKind(pod *v1.Pod) string {
+	kind, _ := w.topOwner(pod)
+	return kind
+}
+
+// topOwner resolves the kind and name of the top level controller of a pod
+func (w *Watcher) topOwner(pod *v1.Pod) (string, string) {
+	for _, owner := range pod.GetOwnerReferences() {
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+		if owner.Kind == "ReplicaSet" {
+			rs, err := w.rsInformer.Lister().ReplicaSets(pod.GetNamespace()).Get(owner.Name)
+			if err == nil {
+				if ref := metav1.GetControllerOf(rs); ref != nil {
+					return ref.Kind, ref.Name
+				}
+			}
+		}
+		return owner.Kind, owner.Name
+	}
+	return "Pod", pod.GetName()
+}
+
+// latestRevisionPods drops the pods of older ReplicaSets of a Deployment
+// while it rolls out, so only the newest pod template is evaluated and
+// coexisting old pods cause no transient conflicts
+func (w *Watcher) latestRevisionPods(pods []*v1.Pod) []*v1.Pod {
+	type revision struct {
+		deployment string
+		number     int64
+	}
+	revisions := make([]*revision, len(pods))
+	latest := map[string]int64{}
+	for i, pod := range pods {
+		deployment, number, ok := w.deploymentRevision(pod)
+		if !ok {
+			continue
+		}
+		revisions[i] = &revision{deployment, number}
+		if number > latest[deployment] {
+			latest[deployment] = number
+		}
+	}
+	result := make([]*v1.Pod, 0, len(pods))
+	for i, pod := range pods {
+		if r := revisions[i]; r != nil && r.number < latest[r.deployment] {
+			continue
+		}
+		result = append(result, pod)
+	}
+	return result
+}
+
+// deploymentRevision resolves the Deployment of a pod and the revision of
+// its ReplicaSet
+func (w *Watcher) deploymentRevision(pod *v1.Pod) (string, int64, bool) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return "", 0, false
+	}
+	rs, err := w.rsInformer.Lister().ReplicaSets(pod.GetNamespace()).Get(owner.Name)
+	if err != nil {
+		return "", 0, false
+	}
+	deployment := metav1.GetControllerOf(rs)
+	if deployment == nil || deployment.Kind != "Deployment" {
+		return "", 0, false
+	}
+	number, err := strconv.ParseInt(rs.GetAnnotations()[DeploymentRevisionAnnotation], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return deployment.Name, number, true
+}
+
+// firstPod returns the first pod by name of the latest revision using the
+// PVC, nil if unused
+func (w *Watcher) firstPod(pvc *v1.PersistentVolumeClaim) *v1.Pod {
+	pods, err := w.podsForPVCs(pvc.GetNamespace(), []*v1.PersistentVolumeClaim{pvc})
+	if err != nil || len(pods) == 0 {
+		return nil
+	}
+	pods = w.latestRevisionPods(pods)
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].GetName() < pods[j].GetName()
+	})
+	return pods[0]
+}
+
+// claimVolume returns the name of the pod volume referencing the PVC
+func claimVolume(pod *v1.Pod, pvcName string) string {
+	for _, volume := range pod.Spec.Volumes {
+		if name, ok := claimName(pod, volume); ok && name == pvcName {
+			return volume.Name
+		}
+	}
+	return ""
+}
+
+// isManaged checks if the pod's owner kind is evaluated
+func (w *Watcher) isManaged(pod *v1.Pod) bool {
+	if len(w.config.OwnerKinds) == 0 {
+		return true
+	}
+	_, ok := w.config.OwnerKinds[w.topOwnerKind(pod)]
+	return ok
+}
+
+// collectUnmanagedPods counts the pods with PVCs that are not evaluated
+func (w *Watcher) collectUnmanagedPods() {
+	w.promUnmanagedPods.Reset()
+	if len(w.config.OwnerKinds) == 0 {
+		return
+	}
+	pods, err := w.podInformer.Lister().List(labels.Everything())
+	if err != nil {
+		log.Printf("unable to list pods: %s", err)
+		return
+	}
+	for _, pod := range pods {
+		if w.isExcludedNamespace(pod.GetNamespace()) || !hasPVCs(pod) || w.isManaged(pod) {
+			continue
+		}
+		w.promUnmanagedPods.WithLabelValues(pod.GetNamespace(), w.topOwnerKind(pod)).Inc()
+	}
+}
+
+// hasPVCs checks if the pod uses any PVC, generic ephemeral volumes
+// included
+func hasPVCs(pod *v1.Pod) bool {
+	return len(claimNames(pod)) > 0
+}
+
+func hasExcludeLabel(obj metav1.Object) bool {
+	return obj.GetLabels()[ExcludeFromBackupLabel] == "true"
+}
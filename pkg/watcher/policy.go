@@ -0,0 +1,235 @@
+package watcher
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	PolicyGatekeeper = "gatekeeper"
+	PolicyKyverno    = "kyverno"
+
+	// PolicyName is the name of the exported admission policies
+	PolicyName = "velero-pvc-watcher"
+)
+
+const gatekeeperRego = `package veleropvcwatcher
+
+violation[{"msg": msg}] {
+  not excluded_namespace
+  not excluded_pod
+  volume := input.review.object.spec.volumes[_]
+  volume.persistentVolumeClaim
+  not listed(volume.name)
+  msg := sprintf("volume %v mounts PVC %v without backup configuration, list it in %v or %v", [volume.name, volume.persistentVolumeClaim.claimName, input.parameters.backupAnnotation, input.parameters.excludeAnnotation])
+}
+
+excluded_namespace {
+  input.parameters.excludeNamespacesRegex != ""
+  regex.match(input.parameters.excludeNamespacesRegex, input.review.namespace)
+}
+
+excluded_pod {
+  input.review.object.metadata.labels[input.parameters.excludeLabel] == "true"
+}
+
+listed(name) {
+  annotation := {input.parameters.backupAnnotation, input.parameters.excludeAnnotation}[_]
+  split(input.review.object.metadata.annotations[annotation], ",")[_] == name
+}
+`
+
+// ExportPolicy renders the admission policy equivalent to the configuration
+// for the policy engine format
+func ExportPolicy(format string, config Config) ([]byte, error) {
+	switch format {
+	case PolicyGatekeeper:
+		return GatekeeperPolicy(config)
+	case PolicyKyverno:
+		return KyvernoPolicy(config)
+	}
+	return nil, fmt.Errorf("unknown policy format %q", format)
+}
+
+// PolicyHandler serves the admission policy for the policy engine given in
+// the `format` query parameter as yaml
+func (w *Watcher) PolicyHandler(rw http.ResponseWriter, r *http.Request) {
+	data, err := ExportPolicy(r.URL.Query().Get("format"), w.config)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/yaml")
+	if _, err := rw.Write(data); err != nil {
+		log.Printf("unable to write response: %s", err)
+	}
+}
+
+// GatekeeperPolicy renders a Gatekeeper ConstraintTemplate and Constraint
+// rejecting pods with PVC volumes that are neither backed up nor excluded,
+// namespaces are excluded like the watcher excludes them
+func GatekeeperPolicy(config Config) ([]byte, error) {
+	excludeNamespaces := ""
+	if config.ExcludeNamespaces != nil {
+		excludeNamespaces = config.ExcludeNamespaces.String()
+	}
+	template := map[string]interface{}{
+		"apiVersion": "templates.gatekeeper.sh/v1",
+		"kind":       "ConstraintTemplate",
+		"metadata": map[string]interface{}{
+			"name": "velerobackupvolumes",
+		},
+		"spec": map[string]interface{}{
+			"crd": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"names": map[string]interface{}{
+						"kind": "VeleroBackupVolumes",
+					},
+					"validation": map[string]interface{}{
+						"openAPIV3Schema": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"excludeNamespacesRegex": map[string]interface{}{"type": "string"},
+								"excludeLabel":           map[string]interface{}{"type": "string"},
+								"backupAnnotation":       map[string]interface{}{"type": "string"},
+								"excludeAnnotation":      map[string]interface{}{"type": "string"},
+							},
+						},
+					},
+				},
+			},
+			"targets": []interface{}{
+				map[string]interface{}{
+					"target": "admission.k8s.gatekeeper.sh",
+					"rego":   gatekeeperRego,
+				},
+			},
+		},
+	}
+	constraint := map[string]interface{}{
+		"apiVersion": "constraints.gatekeeper.sh/v1beta1",
+		"kind":       "VeleroBackupVolumes",
+		"metadata": map[string]interface{}{
+			"name": PolicyName,
+		},
+		"spec": map[string]interface{}{
+			"match": map[string]interface{}{
+				"kinds": []interface{}{
+					map[string]interface{}{
+						"apiGroups": []interface{}{""},
+						"kinds":     []interface{}{"Pod"},
+					},
+				},
+			},
+			"parameters": map[string]interface{}{
+				"excludeNamespacesRegex": excludeNamespaces,
+				"excludeLabel":           ExcludeFromBackupLabel,
+				"backupAnnotation":       BackupAnnotation,
+				"excludeAnnotation":      ExcludeAnnotation,
+			},
+		},
+	}
+	return yamlDocuments(template, constraint)
+}
+
+// KyvernoPolicy renders a Kyverno ClusterPolicy with the same semantics as
+// the Gatekeeper policy
+func KyvernoPolicy(config Config) ([]byte, error) {
+	rule := map[string]interface{}{
+		"name": "backup-volumes",
+		"match": map[string]interface{}{
+			"any": []interface{}{
+				map[string]interface{}{
+					"resources": map[string]interface{}{
+						"kinds": []interface{}{"Pod"},
+					},
+				},
+			},
+		},
+		"exclude": map[string]interface{}{
+			"any": []interface{}{
+				map[string]interface{}{
+					"resources": map[string]interface{}{
+						"selector": map[string]interface{}{
+							"matchLabels": map[string]interface{}{
+								ExcludeFromBackupLabel: "true",
+							},
+						},
+					},
+				},
+			},
+		},
+		"validate": map[string]interface{}{
+			"message": fmt.Sprintf("PVC volumes have to be listed in %s or %s", BackupAnnotation, ExcludeAnnotation),
+			"foreach": []interface{}{
+				map[string]interface{}{
+					"list": "request.object.spec.volumes[?persistentVolumeClaim]",
+					"deny": map[string]interface{}{
+						"conditions": map[string]interface{}{
+							"all": []interface{}{
+								kyvernoNotListed(BackupAnnotation),
+								kyvernoNotListed(ExcludeAnnotation),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if config.ExcludeNamespaces != nil {
+		pattern := strings.ReplaceAll(config.ExcludeNamespaces.String(), "'", `\'`)
+		rule["preconditions"] = map[string]interface{}{
+			"all": []interface{}{
+				map[string]interface{}{
+					"key":      fmt.Sprintf("{{ regex_match('%s', request.namespace) }}", pattern),
+					"operator": "Equals",
+					"value":    false,
+				},
+			},
+		}
+	}
+	policy := map[string]interface{}{
+		"apiVersion": "kyverno.io/v1",
+		"kind":       "ClusterPolicy",
+		"metadata": map[string]interface{}{
+			"name": PolicyName,
+		},
+		"spec": map[string]interface{}{
+			"validationFailureAction": "enforce",
+			"background":              true,
+			"rules":                   []interface{}{rule},
+		},
+	}
+	return yamlDocuments(policy)
+}
+
+// kyvernoNotListed is a condition matching volumes not listed in the
+// comma separated annotation
+func kyvernoNotListed(annotation string) map[string]interface{} {
+	return map[string]interface{}{
+		"key":      "{{ element.name }}",
+		"operator": "AnyNotIn",
+		"value":    fmt.Sprintf(`{{ split(request.object.metadata.annotations."%s" || '', ',') }}`, annotation),
+	}
+}
+
+// yamlDocuments renders the objects as a multi document yaml stream
+func yamlDocuments(objs ...interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	for i, obj := range objs {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
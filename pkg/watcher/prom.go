@@ -0,0 +1,217 @@
+package watcher
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+func (w *Watcher) Describe(ch chan<- *prometheus.Desc) {
+	w.promMissingBackups.Describe(ch)
+	w.promOwnerMissing.Describe(ch)
+	w.promProtected.Describe(ch)
+	w.promPVCStatus.Describe(ch)
+	w.promExcludedVolumes.Describe(ch)
+	w.promAnnotationChanges.Describe(ch)
+	w.promPermissionMissing.Describe(ch)
+	w.promUnmanagedPods.Describe(ch)
+	w.promUnmounted.Describe(ch)
+	w.promAtRisk.Describe(ch)
+	w.promUnprotectedBytes.Describe(ch)
+	w.promUnprotectedCost.Describe(ch)
+	w.promUnprotectedSince.Describe(ch)
+	w.promNotOnboarded.Describe(ch)
+	w.promBackupHooks.Describe(ch)
+	w.promTenantPVCs.Describe(ch)
+	w.promTenantCoverage.Describe(ch)
+	w.promInformerObjects.Describe(ch)
+	w.promInformerLastSync.Describe(ch)
+	w.promAPIServerReachable.Describe(ch)
+	w.promRequestDuration.Describe(ch)
+	w.promUp.Describe(ch)
+	w.promReadOnly.Describe(ch)
+	w.promWarmingUp.Describe(ch)
+	if w.velero != nil {
+		w.velero.describe(ch)
+	}
+}
+
+// Collect evaluates all namespaces and exports the series, concurrent scrapes
+// share the evaluation and are collected one after another
+func (w *Watcher) Collect(ch chan<- prometheus.Metric) {
+	statuses := w.EvaluateAll()
+	w.collectMu.Lock()
+	defer w.collectMu.Unlock()
+	w.promMissingBackups.Reset()
+	w.promOwnerMissing.Reset()
+	w.promProtected.Reset()
+	w.promPVCStatus.Reset()
+	w.promExcludedVolumes.Reset()
+	w.promUnmounted.Reset()
+	w.promAtRisk.Reset()
+	w.promUnprotectedBytes.Reset()
+	w.promUnprotectedCost.Reset()
+	w.promUnprotectedSince.Reset()
+	nsLabels := map[string]prometheus.Labels{}
+	for _, status := range statuses {
+		if _, ok := nsLabels[status.Namespace]; !ok {
+			nsLabels[status.Namespace] = w.namespaceLabels(status.Namespace)
+			// a drop of exclusions to zero is as visible as a spike
+			for _, source := range ExclusionSources {
+				w.promExcludedVolumes.With(mergeLabels(nsLabels[status.Namespace], prometheus.Labels{
+					"source": source,
+				})).Set(0)
+			}
+		}
+		pvcLabels := mergeLabels(nsLabels[status.Namespace], prometheus.Labels{
+			"pvc_name": status.PVCName,
+		})
+		for _, label := range w.config.PVCLabels {
+			pvcLabels[pvcLabelName(label)] = status.Labels[label]
+		}
+		w.promPVCStatus.With(mergeLabels(pvcLabels, prometheus.Labels{
+			"state": status.State,
+		})).Set(1)
+		if status.State == StateExcluded {
+			source := status.Exclusion
+			if source == "" {
+				source = ExclusionConfig
+			}
+			w.promExcludedVolumes.With(mergeLabels(nsLabels[status.Namespace], prometheus.Labels{
+				"source": source,
+			})).Inc()
+		}
+		if status.State == StateProtected {
+			w.promProtected.With(pvcLabels).Set(1)
+		}
+		if status.State == StateUnmounted {
+			w.promUnmounted.With(pvcLabels).Set(1)
+		}
+		if status.State != StateMissing {
+			if status.MissingReason != "" {
+				w.promAtRisk.With(mergeLabels(pvcLabels, prometheus.Labels{
+					"state":  status.State,
+					"reason": status.MissingReason,
+				})).Set(1)
+			}
+			continue
+		}
+		w.promUnprotectedBytes.WithLabelValues(status.Namespace, status.StorageClass).Add(float64(status.Size))
+		if price, ok := w.config.StorageClassPrices[status.StorageClass]; ok {
+			w.promUnprotectedCost.WithLabelValues(status.Namespace, status.StorageClass).Add(float64(status.Size) / (1 << 30) * price)
+		}
+		w.promMissingBackups.With(mergeLabels(pvcLabels, prometheus.Labels{
+			"method": status.Method,
+			"reason": status.MissingReason,
+		})).Set(1)
+		w.promUnprotectedSince.With(pvcLabels).Set(float64(status.UnprotectedSince.Unix()))
+		if kind, name := splitOwner(status.Owner); kind != "" {
+			w.promOwnerMissing.WithLabelValues(status.Namespace, kind, name).Inc()
+		}
+	}
+	w.promMissingBackups.Collect(ch)
+	w.promOwnerMissing.Collect(ch)
+	w.promProtected.Collect(ch)
+	w.promPVCStatus.Collect(ch)
+	w.promExcludedVolumes.Collect(ch)
+	w.promAnnotationChanges.Collect(ch)
+	w.promPermissionMissing.Collect(ch)
+	w.collectUnmanagedPods()
+	w.promUnmanagedPods.Collect(ch)
+	w.promUnmounted.Collect(ch)
+	w.promAtRisk.Collect(ch)
+	w.promUnprotectedBytes.Collect(ch)
+	w.promUnprotectedCost.Collect(ch)
+	w.promUnprotectedSince.Collect(ch)
+	w.collectOnboarding(statuses)
+	w.promNotOnboarded.Collect(ch)
+	w.collectBackupHooks(statuses)
+	w.promBackupHooks.Collect(ch)
+	w.collectTenants(statuses)
+	w.promTenantPVCs.Collect(ch)
+	w.promTenantCoverage.Collect(ch)
+	w.collectInformers(ch)
+	w.promAPIServerReachable.Collect(ch)
+	w.promRequestDuration.Collect(ch)
+	w.collectHealth()
+	w.promUp.Collect(ch)
+	w.promReadOnly.Collect(ch)
+	w.promWarmingUp.Collect(ch)
+	if w.velero != nil {
+		w.velero.collect(ch, statuses)
+	}
+}
+
+// namespaceLabels returns the namespace label, the tenant if mapped and the
+// configured labels copied from the namespace object
+func (w *Watcher) namespaceLabels(namespace string) prometheus.Labels {
+	result := prometheus.Labels{"namespace": namespace}
+	if w.config.Tenants != nil {
+		result["tenant"], _ = w.config.Tenants.Lookup(namespace)
+	}
+	if len(w.config.NamespaceLabels) == 0 {
+		return result
+	}
+	var nsLabels map[string]string
+	if ns, err := w.nsInformer.Lister().Get(namespace); err == nil {
+		nsLabels = ns.GetLabels()
+	}
+	for _, label := range w.config.NamespaceLabels {
+		result[namespaceLabelName(label)] = nsLabels[label]
+	}
+	return result
+}
+
+// namespaceLabelName converts a namespace label to a valid metric label name
+func namespaceLabelName(label string) string {
+	return "namespace_label_" + invalidLabelChars.ReplaceAllString(label, "_")
+}
+
+// splitOwner splits the Kind/name of an owner, empty if the PVC is not used
+// by any pod
+func splitOwner(owner string) (string, string) {
+	parts := strings.SplitN(owner, "/", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// seriesLabelNames returns the labels of the series per namespace and per
+// PVC, the tenant and the copied namespace and PVC labels depend on the
+// config
+func seriesLabelNames(config Config) ([]string, []string) {
+	nsLabelNames := []string{"namespace"}
+	if config.Tenants != nil {
+		nsLabelNames = append(nsLabelNames, "tenant")
+	}
+	for _, label := range config.NamespaceLabels {
+		nsLabelNames = append(nsLabelNames, namespaceLabelName(label))
+	}
+	pvcLabelNames := append(append([]string{}, nsLabelNames...), "pvc_name")
+	for _, label := range config.PVCLabels {
+		pvcLabelNames = append(pvcLabelNames, pvcLabelName(label))
+	}
+	return nsLabelNames, pvcLabelNames
+}
+
+// pvcLabelName converts a PVC label to a valid metric label name
+func pvcLabelName(label string) string {
+	return "label_" + invalidLabelChars.ReplaceAllString(label, "_")
+}
+
+func mergeLabels(base, extra prometheus.Labels) prometheus.Labels {
+	merged := prometheus.Labels{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
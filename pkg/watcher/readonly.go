@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"context"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	// writeVerbs must not be allowed in read-only mode
+	writeVerbs = []string{"create", "update", "patch", "delete"}
+)
+
+// writePermissions lists the resources checked for write access in
+// read-only mode: the watched resources and the ones the optional features
+// write, cluster wide and in the velero namespace
+func (w *Watcher) writePermissions() []Permission {
+	permissions := []Permission{}
+	for _, permission := range w.RequiredPermissions() {
+		permission.Namespace = ""
+		permissions = append(permissions, permission)
+	}
+	permissions = append(permissions,
+		Permission{"", "events", ""},
+		Permission{"", "configmaps", ""},
+		Permission{"", "secrets", ""},
+	)
+	if w.velero == nil {
+		permissions = append(permissions,
+			Permission{BackupResource.Group, BackupResource.Resource, ""},
+			Permission{ScheduleResource.Group, ScheduleResource.Resource, ""},
+		)
+		return permissions
+	}
+	return append(permissions,
+		Permission{BackupResource.Group, BackupResource.Resource, w.velero.namespace},
+		Permission{ScheduleResource.Group, ScheduleResource.Resource, w.velero.namespace},
+		Permission{"", "configmaps", w.velero.namespace},
+	)
+}
+
+// VerifyReadOnly checks with SelfSubjectAccessReviews that the watcher holds
+// no write permissions, it returns the held ones and the failed checks.
+// Grants limited to other namespaces than the velero namespace are not
+// detected.
+func (w *Watcher) VerifyReadOnly(ctx context.Context, client kubernetes.Interface) []CheckResult {
+	held := []CheckResult{}
+	for _, permission := range w.writePermissions() {
+		for _, verb := range writeVerbs {
+			result := checkPermission(ctx, client, permission, verb)
+			switch {
+			case result.Passed:
+				result.Message = "permission held"
+			case result.Message == permissionDenied:
+				continue
+			}
+			result.Passed = false
+			held = append(held, result)
+		}
+	}
+	return held
+}
@@ -0,0 +1,45 @@
+package watcher
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Ready reports if the caches are synced and a full evaluation completed
+func (w *Watcher) Ready() bool {
+	return atomic.LoadInt32(&w.ready) == 1
+}
+
+// markReady flags the watcher ready once all caches are synced
+func (w *Watcher) markReady() {
+	if w.Ready() {
+		return
+	}
+	for _, synced := range w.SyncStatus() {
+		if !synced {
+			return
+		}
+	}
+	atomic.StoreInt32(&w.ready, 1)
+}
+
+// ReadyHandler serves the readiness probe
+func (w *Watcher) ReadyHandler(rw http.ResponseWriter, r *http.Request) {
+	if !w.Ready() {
+		http.Error(rw, "waiting for first evaluation", http.StatusServiceUnavailable)
+		return
+	}
+	rw.Write([]byte("ok\n"))
+}
+
+// RequireReady rejects requests with 503 until the watcher is ready, so
+// Prometheus never scrapes an empty state right after a restart
+func (w *Watcher) RequireReady(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !w.Ready() {
+			http.Error(rw, "waiting for first evaluation", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,78 @@
+package watcher
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// ReasonNoAnnotation marks missing PVCs no pod lists for backup
+	ReasonNoAnnotation = "no_annotation"
+	// ReasonNoSchedule marks missing PVCs in namespaces no velero schedule
+	// covers, an annotation alone does not protect them
+	ReasonNoSchedule = "no_schedule"
+	// ReasonNoNodeAgent marks missing PVCs with a fs-backup configuration
+	// of pods on virtual nodes, the velero node-agent can not run there
+	ReasonNoNodeAgent = "no_node_agent"
+	// ReasonBlockMode marks missing PVCs with a fs-backup configuration
+	// in volume mode Block, fs-backup only copies filesystems
+	ReasonBlockMode = "block_mode"
+	// ReasonNoSnapshotSupport marks missing PVCs whose provisioner can not
+	// be snapshotted by the installed velero plugins
+	ReasonNoSnapshotSupport = "no-snapshot-support"
+	// ReasonRule marks PVCs a classification rule reports as missing
+	ReasonRule = "rule"
+	// ReasonPolicy marks PVCs an OPA policy reports as missing
+	ReasonPolicy = "policy"
+
+	// ReasonExcludedConflict marks excluded PVCs a pod lists in
+	// BackupAnnotation or an opt-out schedule backs up, the exclusion on the
+	// PVC contradicts the backup configuration
+	ReasonExcludedConflict = "excluded_conflict"
+	// ReasonUnmounted marks PVCs with a backup configuration no container
+	// mounts, fs-backup skips them
+	ReasonUnmounted = "unmounted"
+	// ReasonStaleBackup marks protected PVCs whose namespace had no
+	// completed velero backup within Config.StaleBackupAge
+	ReasonStaleBackup = "stale_backup"
+
+	// ExclusionPodAnnotation marks PVCs a pod lists in ExcludeAnnotation
+	ExclusionPodAnnotation = "pod_annotation"
+	// ExclusionPVCAnnotation marks PVCs annotated with ExcludePVCAnnotation
+	ExclusionPVCAnnotation = "pvc_annotation"
+	// ExclusionConfig marks PVCs excluded by the watcher configuration, e.g.
+	// --pvc-excluded, --exclude-pods-selector, rules or policies
+	ExclusionConfig = "config"
+)
+
+var (
+	// MissingReasons are the values of the reason label of missing PVCs
+	MissingReasons = []string{
+		ReasonNoAnnotation,
+		ReasonNoSchedule,
+		ReasonNoNodeAgent,
+		ReasonBlockMode,
+		ReasonNoSnapshotSupport,
+		ReasonRule,
+		ReasonPolicy,
+	}
+
+	// RiskReasons are the values of the reason label of PVCs that are not
+	// missing but at risk
+	RiskReasons = []string{
+		ReasonExcludedConflict,
+		ReasonUnmounted,
+		ReasonStaleBackup,
+	}
+
+	// ExclusionSources are the values of the source label of excluded PVCs
+	ExclusionSources = []string{
+		ExclusionPodAnnotation,
+		ExclusionPVCAnnotation,
+		ExclusionConfig,
+	}
+)
+
+// isBlockMode checks if the PVC is a raw block volume
+func isBlockMode(pvc *v1.PersistentVolumeClaim) bool {
+	return pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == v1.PersistentVolumeBlock
+}
@@ -0,0 +1,194 @@
+package watcher
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+type (
+	// Remediation is a strategic merge patch adding the missing volumes to
+	// the backup annotation of a workload's pod template
+	Remediation struct {
+		Namespace string   `json:"namespace"`
+		Kind      string   `json:"kind"`
+		Name      string   `json:"name"`
+		Volumes   []string `json:"volumes"`
+		Patch     string   `json:"patch"`
+	}
+)
+
+var (
+	// api versions of the workloads a patch can be generated for
+	remediationAPIVersions = map[string]string{
+		"Pod":         "v1",
+		"Deployment":  "apps/v1",
+		"StatefulSet": "apps/v1",
+		"DaemonSet":   "apps/v1",
+		"ReplicaSet":  "apps/v1",
+		"Job":         "batch/v1",
+	}
+)
+
+// Remediations generates a patch for every workload that mounts PVCs
+// without backup configuration, ordered by namespace, kind and name
+func (w *Watcher) Remediations() []Remediation {
+	remediations := []Remediation{}
+	nsList, _ := w.ListNamespaces()
+	for _, ns := range nsList {
+		if w.isExcludedNamespace(ns.GetName()) {
+			continue
+		}
+		remediations = append(remediations, w.namespaceRemediations(ns.GetName())...)
+	}
+	return remediations
+}
+
+func (w *Watcher) namespaceRemediations(namespace string) []Remediation {
+	statuses, _ := w.evaluate(namespace)
+	missing := map[string]struct{}{}
+	for _, status := range statuses {
+		if status.State == StateMissing {
+			missing[status.PVCName] = struct{}{}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	pods, err := w.podInformer.Lister().Pods(namespace).List(labels.Everything())
+	if err != nil {
+		log.Printf("unable to list pods: %s", err)
+		return nil
+	}
+
+	// collect the missing volumes per workload, pods of the same workload
+	// share the pod template
+	byOwner := map[string]*Remediation{}
+	existing := map[string]string{}
+	for _, pod := range pods {
+		volumes := []string{}
+		for _, volume := range pod.Spec.Volumes {
+			pvcName, ok := claimName(pod, volume)
+			if !ok {
+				continue
+			}
+			if _, ok := missing[pvcName]; ok {
+				volumes = append(volumes, volume.Name)
+			}
+		}
+		if len(volumes) == 0 {
+			continue
+		}
+		kind, name := w.topOwner(pod)
+		if _, ok := remediationAPIVersions[kind]; !ok {
+			continue
+		}
+		key := kind + "/" + name
+		r, ok := byOwner[key]
+		if !ok {
+			r = &Remediation{Namespace: namespace, Kind: kind, Name: name}
+			byOwner[key] = r
+			existing[key] = pod.GetAnnotations()[BackupAnnotation]
+		}
+		r.Volumes = appendMissing(r.Volumes, volumes...)
+	}
+
+	remediations := []Remediation{}
+	for key, r := range byOwner {
+		sort.Strings(r.Volumes)
+		patch, err := remediationPatch(*r, existing[key])
+		if err != nil {
+			log.Printf("unable to generate patch for %s/%s: %s", namespace, key, err)
+			continue
+		}
+		r.Patch = patch
+		remediations = append(remediations, *r)
+	}
+	sort.Slice(remediations, func(i, j int) bool {
+		if remediations[i].Kind != remediations[j].Kind {
+			return remediations[i].Kind < remediations[j].Kind
+		}
+		return remediations[i].Name < remediations[j].Name
+	})
+	return remediations
+}
+
+// remediationPatch renders the strategic merge patch, the volumes already
+// listed in the annotation are kept
+func remediationPatch(r Remediation, existing string) (string, error) {
+	volumes := []string{}
+	if existing != "" {
+		volumes = strings.Split(existing, ",")
+	}
+	annotations := map[string]interface{}{
+		BackupAnnotation: strings.Join(appendMissing(volumes, r.Volumes...), ","),
+	}
+	patch := map[string]interface{}{
+		"apiVersion": remediationAPIVersions[r.Kind],
+		"kind":       r.Kind,
+		"metadata": map[string]interface{}{
+			"name":      r.Name,
+			"namespace": r.Namespace,
+		},
+	}
+	if r.Kind == "Pod" {
+		patch["metadata"].(map[string]interface{})["annotations"] = annotations
+	} else {
+		patch["spec"] = map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": annotations,
+				},
+			},
+		}
+	}
+	data, err := yaml.Marshal(patch)
+	return string(data), err
+}
+
+// WriteRemediations writes every patch and a kustomization.yaml referencing
+// them into dir
+func WriteRemediations(dir string, remediations []Remediation) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	files := []string{}
+	for _, r := range remediations {
+		file := strings.ToLower(fmt.Sprintf("%s-%s-%s.yaml", r.Namespace, r.Kind, r.Name))
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(r.Patch), 0644); err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	kustomization, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion":            "kustomize.config.k8s.io/v1beta1",
+		"kind":                  "Kustomization",
+		"patchesStrategicMerge": files,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "kustomization.yaml"), kustomization, 0644)
+}
+
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, known := range list {
+			if known == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,204 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// RemoteWriteTimeout limits a single remote-write request
+	RemoteWriteTimeout = 30 * time.Second
+)
+
+type (
+	// RemoteWrite pushes the gathered metrics to a Prometheus remote-write
+	// endpoint, e.g. of Mimir, Thanos or VictoriaMetrics
+	RemoteWrite struct {
+		URL      string
+		Interval time.Duration
+		// Headers are added to every request, e.g. X-Scope-OrgID
+		Headers map[string]string
+		// Labels are added to every series, like the job and instance
+		// labels a scraping Prometheus adds
+		Labels map[string]string
+	}
+
+	// remoteSample is a single sample of a series with sorted labels
+	remoteSample struct {
+		labels []*dto.LabelPair
+		value  float64
+	}
+)
+
+// RunRemoteWrite gathers the metrics every interval, delayed by up to
+// Config.EvaluationJitter, and pushes them to the remote-write endpoint,
+// failed pushes are not retried, the next push carries the current values
+func (w *Watcher) RunRemoteWrite(gatherer prometheus.Gatherer, target RemoteWrite, stopper <-chan struct{}) {
+	client := &http.Client{Timeout: RemoteWriteTimeout}
+	ticker := time.NewTicker(target.Interval)
+	defer ticker.Stop()
+	jitter := newJitter(w.config.EvaluationJitter)
+	for {
+		if !jitter.wait(stopper) {
+			return
+		}
+		if err := target.push(client, gatherer, time.Now()); err != nil {
+			log.Printf("unable to push metrics to %s: %s", target.URL, err)
+			w.setHealth(ComponentRemoteWrite, false)
+		} else {
+			w.setHealth(ComponentRemoteWrite, true)
+		}
+		select {
+		case <-stopper:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r RemoteWrite) push(client *http.Client, gatherer prometheus.Gatherer, now time.Time) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		log.Printf("unable to gather all metrics: %s", err)
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(r.samples(families), now.UnixNano()/int64(time.Millisecond)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), RemoteWriteTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range r.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// samples flattens the families into series the way Prometheus stores
+// them, histograms and summaries are split into their _bucket, _sum and
+// _count series
+func (r RemoteWrite) samples(families []*dto.MetricFamily) []remoteSample {
+	samples := []remoteSample{}
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.Metric {
+			add := func(suffix string, value float64, extra ...*dto.LabelPair) {
+				samples = append(samples, remoteSample{
+					labels: r.labels(name+suffix, metric.Label, extra),
+					value:  value,
+				})
+			}
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				add("", metric.GetGauge().GetValue())
+			case dto.MetricType_COUNTER:
+				add("", metric.GetCounter().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.Bucket {
+					add("_bucket", float64(bucket.GetCumulativeCount()), labelPair("le", formatFloat(bucket.GetUpperBound())))
+				}
+				add("_bucket", float64(histogram.GetSampleCount()), labelPair("le", "+Inf"))
+				add("_sum", histogram.GetSampleSum())
+				add("_count", float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.Quantile {
+					add("", quantile.GetValue(), labelPair("quantile", formatFloat(quantile.GetQuantile())))
+				}
+				add("_sum", summary.GetSampleSum())
+				add("_count", float64(summary.GetSampleCount()))
+			}
+		}
+	}
+	return samples
+}
+
+// labels merges the name, the metric labels and the target labels sorted by
+// name, labels of the metric win
+func (r RemoteWrite) labels(name string, pairs []*dto.LabelPair, extra []*dto.LabelPair) []*dto.LabelPair {
+	merged := map[string]string{}
+	for k, v := range r.Labels {
+		merged[k] = v
+	}
+	for _, pair := range append(append([]*dto.LabelPair{}, pairs...), extra...) {
+		merged[pair.GetName()] = pair.GetValue()
+	}
+	merged["__name__"] = name
+	result := make([]*dto.LabelPair, 0, len(merged))
+	for k, v := range merged {
+		result = append(result, labelPair(k, v))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result
+}
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest protobuf message
+// with one sample per series
+func encodeWriteRequest(samples []remoteSample, timestamp int64) []byte {
+	request := []byte{}
+	for _, sample := range samples {
+		series := []byte{}
+		for _, label := range sample.labels {
+			pair := []byte{}
+			pair = protowire.AppendTag(pair, 1, protowire.BytesType)
+			pair = protowire.AppendString(pair, label.GetName())
+			pair = protowire.AppendTag(pair, 2, protowire.BytesType)
+			pair = protowire.AppendString(pair, label.GetValue())
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, pair)
+		}
+		value := []byte{}
+		value = protowire.AppendTag(value, 1, protowire.Fixed64Type)
+		value = protowire.AppendFixed64(value, math.Float64bits(sample.value))
+		value = protowire.AppendTag(value, 2, protowire.VarintType)
+		value = protowire.AppendVarint(value, uint64(timestamp))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, value)
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, series)
+	}
+	return request
+}
@@ -0,0 +1,146 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// writeRequestDescriptor describes the messages of prompb/remote.proto and
+// prompb/types.proto used by remote-write 1.0
+func writeRequestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, repeated bool, typeName string) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    label.Enum(),
+			Type:     kind.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(".prometheus." + typeName)
+		}
+		return f
+	}
+	message := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("remote.proto"),
+		Package: proto.String("prometheus"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("WriteRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("timeseries", 1, message, true, "TimeSeries"),
+			}},
+			{Name: proto.String("TimeSeries"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("labels", 1, message, true, "Label"),
+				field("samples", 2, message, true, "Sample"),
+			}},
+			{Name: proto.String("Label"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+				field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, false, ""),
+			}},
+			{Name: proto.String("Sample"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("value", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, false, ""),
+				field("timestamp", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, false, ""),
+			}},
+		},
+	}
+	descriptor, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return descriptor.Messages().ByName("WriteRequest")
+}
+
+// decodeWriteRequest decodes a snappy compressed WriteRequest into one line
+// per sample: {name="value",...} value timestamp
+func decodeWriteRequest(t *testing.T, body []byte) []string {
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("snappy: %s", err)
+	}
+	request := dynamicpb.NewMessage(writeRequestDescriptor(t))
+	if err := proto.Unmarshal(data, request); err != nil {
+		t.Fatalf("protobuf: %s", err)
+	}
+	get := func(m protoreflect.Message, name protoreflect.Name) protoreflect.Value {
+		return m.Get(m.Descriptor().Fields().ByName(name))
+	}
+	lines := []string{}
+	timeseries := get(request, "timeseries").List()
+	for i := 0; i < timeseries.Len(); i++ {
+		series := timeseries.Get(i).Message()
+		pairs := []string{}
+		labels := get(series, "labels").List()
+		for j := 0; j < labels.Len(); j++ {
+			label := labels.Get(j).Message()
+			pairs = append(pairs, fmt.Sprintf("%s=%q", get(label, "name").String(), get(label, "value").String()))
+		}
+		samples := get(series, "samples").List()
+		for j := 0; j < samples.Len(); j++ {
+			sample := samples.Get(j).Message()
+			lines = append(lines, fmt.Sprintf("{%s} %g %d", strings.Join(pairs, ","), get(sample, "value").Float(), get(sample, "timestamp").Int()))
+		}
+	}
+	return lines
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	gauge := dto.MetricType_GAUGE
+	histogram := dto.MetricType_HISTOGRAM
+	name := func(s string) *string { return &s }
+	float := func(f float64) *float64 { return &f }
+	count := func(c uint64) *uint64 { return &c }
+	families := []*dto.MetricFamily{
+		{
+			Name: name("backupmonitor_missing"),
+			Type: &gauge,
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{labelPair("persistentvolumeclaim", "data-redis-0"), labelPair("namespace", "shop")},
+				Gauge: &dto.Gauge{Value: float(1)},
+			}},
+		},
+		{
+			Name: name("backupmonitor_evaluation_seconds"),
+			Type: &histogram,
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount: count(3),
+					SampleSum:   float(0.75),
+					Bucket:      []*dto.Bucket{{UpperBound: float(0.5), CumulativeCount: count(2)}},
+				},
+			}},
+		},
+	}
+	target := RemoteWrite{Labels: map[string]string{"job": "backupmonitor", "namespace": "monitoring"}}
+	body := snappy.Encode(nil, encodeWriteRequest(target.samples(families), 1700000000000))
+
+	expected := []string{
+		`{__name__="backupmonitor_missing",job="backupmonitor",namespace="shop",persistentvolumeclaim="data-redis-0"} 1 1700000000000`,
+		`{__name__="backupmonitor_evaluation_seconds_bucket",job="backupmonitor",le="0.5",namespace="monitoring"} 2 1700000000000`,
+		`{__name__="backupmonitor_evaluation_seconds_bucket",job="backupmonitor",le="+Inf",namespace="monitoring"} 3 1700000000000`,
+		`{__name__="backupmonitor_evaluation_seconds_sum",job="backupmonitor",namespace="monitoring"} 0.75 1700000000000`,
+		`{__name__="backupmonitor_evaluation_seconds_count",job="backupmonitor",namespace="monitoring"} 3 1700000000000`,
+	}
+	lines := decodeWriteRequest(t, body)
+	if len(lines) != len(expected) {
+		t.Fatalf("got %d samples, expected %d:\n%s", len(lines), len(expected), strings.Join(lines, "\n"))
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("sample %d is\n%s\nexpected\n%s", i, lines[i], expected[i])
+		}
+	}
+}
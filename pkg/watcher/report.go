@@ -0,0 +1,165 @@
+package watcher
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatTable = "table"
+	FormatSARIF = "sarif"
+)
+
+type (
+	// Report is the result of an evaluation for machine readable output
+	Report struct {
+		Summary Summary       `json:"summary"`
+		PVCs    []ReportEntry `json:"pvcs"`
+	}
+
+	// ReportEntry is the classification of a single PVC
+	ReportEntry struct {
+		Namespace    string `json:"namespace"`
+		PVCName      string `json:"pvc_name"`
+		State        string `json:"state"`
+		Method       string `json:"method"`
+		Reason       string `json:"reason"`
+		StorageClass string `json:"storage_class,omitempty"`
+		Size         int64  `json:"size"`
+		Owner        string `json:"owner,omitempty"`
+		Volume       string `json:"volume,omitempty"`
+	}
+)
+
+// NewReport builds a report from the statuses of an evaluation
+func NewReport(t time.Time, statuses []PVCStatus) Report {
+	report := Report{
+		Summary: Summarize(t, statuses),
+		PVCs:    []ReportEntry{},
+	}
+	for _, status := range statuses {
+		report.PVCs = append(report.PVCs, ReportEntry{
+			Namespace:    status.Namespace,
+			PVCName:      status.PVCName,
+			State:        status.State,
+			Method:       status.Method,
+			Reason:       status.Reason,
+			StorageClass: status.StorageClass,
+			Size:         status.Size,
+			Owner:        status.Owner,
+			Volume:       status.Volume,
+		})
+	}
+	// the listers return the PVCs in map order, sorting keeps the output of
+	// identical runs identical and the rows of a namespace together
+	sort.Slice(report.PVCs, func(i, j int) bool {
+		a, b := report.PVCs[i], report.PVCs[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.PVCName < b.PVCName
+	})
+	return report
+}
+
+// WriteReport writes the report in one of the formats yaml, table, sarif or
+// of the ReportEncoders, color only applies to the table
+func WriteReport(out io.Writer, format string, report Report, color bool) error {
+	if encoder, ok := ReportEncoders[format]; ok {
+		return encoder.EncodeReport(out, report)
+	}
+	switch format {
+	case FormatYAML:
+		data, err := yaml.Marshal(report)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	case FormatTable:
+		return writeTable(out, report, color)
+	case FormatSARIF:
+		return encodeJSON(out, newSARIF(report))
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// stateColors are the ANSI colors of the states in the table, all codes
+// have the same length to keep the columns aligned
+var stateColors = map[string]string{
+	StateProtected: "\x1b[32m",
+	StateMissing:   "\x1b[31m",
+	StateUnmounted: "\x1b[33m",
+	StateExcluded:  "\x1b[90m",
+	StateUnmanaged: "\x1b[90m",
+}
+
+const (
+	colorBold  = "\x1b[1m"
+	colorReset = "\x1b[0m"
+)
+
+// writeTable writes one table per namespace, missing PVCs are red and
+// protected ones green if color is enabled
+func writeTable(out io.Writer, report Report, color bool) error {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + colorReset
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	namespace := ""
+	for _, entry := range report.PVCs {
+		if entry.Namespace != namespace {
+			if namespace != "" {
+				fmt.Fprintln(tw)
+			}
+			namespace = entry.Namespace
+			ns := report.Summary.Namespaces[namespace]
+			fmt.Fprintf(tw, "%s  %d PVCs, %d missing, coverage %.1f%%\n",
+				paint(colorBold, namespace), ns.Total, ns.States[StateMissing], ns.Coverage*100)
+			fmt.Fprintln(tw, "  OWNER\tVOLUME\tPVC\tSIZE\tSTATUS\tREASON")
+		}
+		code, ok := stateColors[entry.State]
+		if !ok {
+			code = stateColors[StateExcluded]
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n",
+			orDash(entry.Owner), orDash(entry.Volume), entry.PVCName, formatSize(entry.Size), paint(code, entry.State), entry.Reason)
+	}
+	fmt.Fprintf(tw, "\n%d PVCs, %d missing, coverage %.1f%%\n",
+		report.Summary.Total, report.Summary.States[StateMissing], report.Summary.Coverage*100)
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatSize formats bytes with binary units like kubernetes quantities
+func formatSize(size int64) string {
+	if size <= 0 {
+		return "-"
+	}
+	units := []string{"", "Ki", "Mi", "Gi", "Ti", "Pi"}
+	value, unit := float64(size), 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if value == float64(int64(value)) {
+		return fmt.Sprintf("%d%s", int64(value), units[unit])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
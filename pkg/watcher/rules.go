@@ -0,0 +1,143 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/checker/decls"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"k8s.io/api/core/v1"
+)
+
+type (
+	// Rule overrides the classification of all PVCs matching a CEL
+	// expression, e.g. excluded:pvc.labels["tier"] == "cache"
+	Rule struct {
+		State      string
+		Expression string
+		program    cel.Program
+	}
+)
+
+// ParseRule parses a rule of the form <state>:<expression>, state is one of
+// protected, excluded or missing
+func ParseRule(s string) (Rule, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("expected <state>:<expression>, got %q", s)
+	}
+	rule := Rule{State: strings.TrimSpace(parts[0]), Expression: strings.TrimSpace(parts[1])}
+	switch rule.State {
+	case StateProtected, StateExcluded, StateMissing:
+	default:
+		return Rule{}, fmt.Errorf("unknown state %q in %q, expected protected, excluded or missing", rule.State, s)
+	}
+	program, err := compileRule(rule.Expression)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid expression %q: %w", rule.Expression, err)
+	}
+	rule.program = program
+	return rule, nil
+}
+
+// compileRule compiles a CEL expression over the rule variables pvc, pod and
+// state, it has to result in a bool
+func compileRule(expression string) (cel.Program, error) {
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("pvc", decls.NewMapType(decls.String, decls.Dyn)),
+		decls.NewVar("pod", decls.NewMapType(decls.String, decls.Dyn)),
+		decls.NewVar("state", decls.String),
+	))
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	switch result := ast.ResultType(); {
+	case result.GetPrimitive() == exprpb.Type_BOOL, result.GetDyn() != nil:
+	default:
+		return nil, fmt.Errorf("expected a bool result, got %s", checker.FormatCheckedType(result))
+	}
+	return env.Program(ast)
+}
+
+func (r Rule) String() string {
+	return r.State + ":" + r.Expression
+}
+
+// Matches reports whether the expression evaluates to true for the
+// variables, failing expressions (e.g. a missing map key) do not match
+func (r Rule) Matches(vars map[string]interface{}) bool {
+	if r.program == nil {
+		return false
+	}
+	result, _, err := r.program.Eval(vars)
+	if err != nil {
+		return false
+	}
+	matched, ok := result.Value().(bool)
+	return ok && matched
+}
+
+// applyRules overrides the state of a PVC with the first matching rule, the
+// missing reason of the fixed classification no longer applies
+func (w *Watcher) applyRules(status *PVCStatus, vars map[string]interface{}) {
+	for _, rule := range w.config.Rules {
+		if rule.Matches(vars) {
+			status.State = rule.State
+			status.Reason = "pvc matches rule " + rule.String()
+			status.MissingReason = ""
+			status.Exclusion = ""
+			if rule.State == StateMissing {
+				status.MissingReason = ReasonRule
+			}
+			return
+		}
+	}
+}
+
+// ruleVars returns the variables the rules and policies see: the pvc, the
+// first pod using it and the state the fixed classification resulted in
+func (w *Watcher) ruleVars(status PVCStatus, pvc *v1.PersistentVolumeClaim) map[string]interface{} {
+	return map[string]interface{}{
+		"pvc": map[string]interface{}{
+			"name":             pvc.GetName(),
+			"namespace":        pvc.GetNamespace(),
+			"labels":           stringMap(pvc.GetLabels()),
+			"annotations":      stringMap(pvc.GetAnnotations()),
+			"storageClassName": status.StorageClass,
+			"size":             status.Size,
+		},
+		"pod":   w.rulePod(pvc),
+		"state": status.State,
+	}
+}
+
+// rulePod returns the first pod by name using the PVC, empty if unused
+func (w *Watcher) rulePod(pvc *v1.PersistentVolumeClaim) map[string]interface{} {
+	pod := map[string]interface{}{
+		"name":        "",
+		"labels":      map[string]interface{}{},
+		"annotations": map[string]interface{}{},
+	}
+	first := w.firstPod(pvc)
+	if first == nil {
+		return pod
+	}
+	pod["name"] = first.GetName()
+	pod["labels"] = stringMap(first.GetLabels())
+	pod["annotations"] = stringMap(first.GetAnnotations())
+	return pod
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
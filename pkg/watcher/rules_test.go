@@ -0,0 +1,113 @@
+package watcher
+
+import (
+	"testing"
+)
+
+func ruleTestVars() map[string]interface{} {
+	return map[string]interface{}{
+		"pvc": map[string]interface{}{
+			"name":             "data-redis-0",
+			"namespace":        "shop",
+			"labels":           map[string]interface{}{"tier": "cache"},
+			"annotations":      map[string]interface{}{},
+			"storageClassName": "local-path",
+			"size":             int64(10 << 30),
+		},
+		"pod": map[string]interface{}{
+			"name":        "redis-0",
+			"labels":      map[string]interface{}{"app": "redis"},
+			"annotations": map[string]interface{}{},
+		},
+		"state": StateProtected,
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		ok   bool
+	}{
+		{`excluded:pvc.labels["tier"] == "cache"`, true},
+		{`missing:state == "protected" && pvc.storageClassName in ["local-path"]`, true},
+		{`protected:has(pvc.labels.tier)`, true},
+		{`excluded:pvc.name`, true}, // dyn, checked on evaluation
+		{`unmanaged:true`, false},
+		{`excluded`, false},
+		{`excluded:pvc.labels["tier"] ==`, false},
+		{`excluded:state`, false},
+		{`excluded:size(state) + 1`, false},
+		{`excluded:node.name == "a"`, false},
+		{`excluded:state == 1`, false},
+	}
+	for _, test := range tests {
+		_, err := ParseRule(test.rule)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("ParseRule(%q) error = %v, expected ok %t", test.rule, err, test.ok)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		expression string
+		matches    bool
+	}{
+		{`pvc.labels["tier"] == "cache"`, true},
+		{`pvc.labels.tier == "cache"`, true},
+		{`pvc.storageClassName in ["local-path", "hostpath"]`, true},
+		{`pvc.size >= 10737418240`, true},
+		{`pvc.size > 10737418240`, false},
+		{`size(pvc.labels) == 1`, true},
+		{`pvc.name.startsWith("data-") && pvc.name.endsWith("-0")`, true},
+		{`pvc.name.matches("^data-[a-z]+-[0-9]+$")`, true},
+		{`pod.labels.app.contains("edi")`, true},
+		// a missing key fails, failing expressions do not match
+		{`pvc.labels["team"] == "shop"`, false},
+		{`has(pvc.labels.team) && pvc.labels.team == "shop"`, false},
+		{`"team" in pvc.labels`, false},
+		// an error is absorbed if the other operand decides the result
+		{`pvc.labels["team"] == "shop" || state == "protected"`, true},
+		// && binds stronger than ||
+		{`state == "missing" && false || true`, true},
+		{`state == "missing" && (false || true)`, false},
+		{`!(state == "protected")`, false},
+		// not a bool at runtime
+		{`pvc.name`, false},
+	}
+	for _, test := range tests {
+		rule, err := ParseRule(StateExcluded + ":" + test.expression)
+		if err != nil {
+			t.Errorf("ParseRule(%q): %s", test.expression, err)
+			continue
+		}
+		if matches := rule.Matches(ruleTestVars()); matches != test.matches {
+			t.Errorf("%q matches = %t, expected %t", test.expression, matches, test.matches)
+		}
+	}
+}
+
+func TestApplyRulesMissingReason(t *testing.T) {
+	tests := []struct {
+		rule          string
+		state         string
+		missingReason string
+	}{
+		{`excluded:pvc.labels.tier == "cache"`, StateExcluded, ""},
+		{`protected:pvc.labels.tier == "cache"`, StateProtected, ""},
+		{`missing:pvc.labels.tier == "cache"`, StateMissing, ReasonRule},
+		{`excluded:pvc.labels.tier == "db"`, StateMissing, ReasonNoAnnotation},
+	}
+	for _, test := range tests {
+		rule, err := ParseRule(test.rule)
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %s", test.rule, err)
+		}
+		w := &Watcher{config: Config{Rules: []Rule{rule}}}
+		status := PVCStatus{State: StateMissing, MissingReason: ReasonNoAnnotation}
+		w.applyRules(&status, ruleTestVars())
+		if status.State != test.state || status.MissingReason != test.missingReason {
+			t.Errorf("%q resulted in %s/%q, expected %s/%q", test.rule, status.State, status.MissingReason, test.state, test.missingReason)
+		}
+	}
+}
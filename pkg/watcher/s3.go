@@ -0,0 +1,320 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// S3DefaultRegion is used if no region is configured, like velero
+	S3DefaultRegion = "us-east-1"
+)
+
+type (
+	// S3Target is the bucket the coverage reports are uploaded to, the
+	// fields match the config of a velero BackupStorageLocation
+	S3Target struct {
+		Bucket string
+		// Prefix is prepended to the object names
+		Prefix string
+		Region string
+		// S3URL is the endpoint of S3-compatible storage like MinIO,
+		// objects are addressed path-style if set
+		S3URL string
+		// CredentialsFile is an AWS shared credentials file, like the
+		// `cloud` key of the velero credentials secret, the AWS_*
+		// environment variables are used if empty
+		CredentialsFile string
+		Profile         string
+	}
+
+	// s3Credentials is an AWS access key
+	s3Credentials struct {
+		accessKeyID     string
+		secretAccessKey string
+		sessionToken    string
+	}
+)
+
+// EnableReportS3 uploads the coverage report of every weekly or monthly
+// period in the format json, csv, markdown or html to the bucket, it has to
+// be called before Run
+func (w *Watcher) EnableReportS3(target S3Target, period, format string) error {
+	if err := target.Validate(); err != nil {
+		return err
+	}
+	encoder, err := NewReportEncoder(format)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: ReportTimeout}
+	return w.enableReports(period, reportSink{
+		name: "s3://" + path.Join(target.Bucket, target.Prefix),
+		deliver: func(report CoverageReport) error {
+			body := &bytes.Buffer{}
+			if err := encoder.EncodeCoverageReport(body, report); err != nil {
+				return fmt.Errorf("unable to encode report: %w", err)
+			}
+			// credentials are read on every upload to pick up rotated secrets
+			credentials, err := target.credentials()
+			if err != nil {
+				return err
+			}
+			key := path.Join(target.Prefix, report.Period, report.From.UTC().Format("2006-01-02")+"."+encoder.Extension())
+			return target.put(client, credentials, key, encoder.ContentType(), body.Bytes())
+		},
+	})
+}
+
+// Validate checks that the bucket is set and the endpoint is an http(s) url
+func (t S3Target) Validate() error {
+	if t.Bucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if t.S3URL != "" {
+		if err := ValidateHTTPURL(t.S3URL); err != nil {
+			return fmt.Errorf("invalid s3 url: %w", err)
+		}
+	}
+	return nil
+}
+
+// objectURL addresses the object path-style at the custom endpoint or
+// virtual-hosted-style at AWS
+func (t S3Target) objectURL(key string) (*url.URL, error) {
+	region := t.Region
+	if region == "" {
+		region = S3DefaultRegion
+	}
+	if t.S3URL == "" {
+		return url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", t.Bucket, region, key))
+	}
+	u, err := url.Parse(t.S3URL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join("/", u.Path, t.Bucket, key)
+	return u, nil
+}
+
+func (t S3Target) credentials() (s3Credentials, error) {
+	if t.CredentialsFile == "" {
+		credentials := s3Credentials{
+			accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+			return credentials, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+		}
+		return credentials, nil
+	}
+	profile := t.Profile
+	if profile == "" {
+		profile = "default"
+	}
+	return readS3Credentials(t.CredentialsFile, profile)
+}
+
+// readS3Credentials reads a profile of an AWS shared credentials file
+func readS3Credentials(file, profile string) (s3Credentials, error) {
+	credentials := s3Credentials{}
+	f, err := os.Open(file)
+	if err != nil {
+		return credentials, err
+	}
+	defer f.Close()
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if section != profile || len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "aws_access_key_id":
+			credentials.accessKeyID = value
+		case "aws_secret_access_key":
+			credentials.secretAccessKey = value
+		case "aws_session_token":
+			credentials.sessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return credentials, err
+	}
+	if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+		return credentials, fmt.Errorf("no access key in profile %s of %s", profile, file)
+	}
+	return credentials, nil
+}
+
+// put uploads the object signed with AWS signature version 4
+func (t S3Target) put(client *http.Client, credentials s3Credentials, key, contentType string, body []byte) error {
+	u, err := t.objectURL(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ReportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	region := t.Region
+	if region == "" {
+		region = S3DefaultRegion
+	}
+	signS3Request(req, credentials, region, body, time.Now())
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s uploading %s", resp.Status, key)
+	}
+	return nil
+}
+
+// signS3Request adds the AWS signature version 4 authorization header for
+// the s3 service, all headers set so far are signed
+func signS3Request(req *http.Request, credentials s3Credentials, region string, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if credentials.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+	canonicalHeaders, signedHeaders := canonicalS3Headers(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		canonicalS3Query(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalS3Headers returns the canonical headers and the signed header
+// names, the host and all headers but the authorization are signed
+func canonicalS3Headers(req *http.Request) (string, string) {
+	values := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		values["host"] = req.Host
+	}
+	for name, header := range req.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" {
+			continue
+		}
+		trimmed := make([]string, len(header))
+		for i, value := range header {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		values[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonical := ""
+	for _, name := range names {
+		canonical += name + ":" + values[name] + "\n"
+	}
+	return canonical, strings.Join(names, ";")
+}
+
+// canonicalS3Query sorts the query parameters by name and value, names and
+// values are encoded and parameters without value get an empty one
+func canonicalS3Query(query url.Values) string {
+	params := [][2]string{}
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, [2]string{awsURIEncode(name, true), awsURIEncode(value, true)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	pairs := make([]string, len(params))
+	for i, param := range params {
+		pairs[i] = param[0] + "=" + param[1]
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode percent-encodes all bytes but the unreserved characters of
+// RFC 3986, slashes are kept unless encodeSlash is set
+func awsURIEncode(s string, encodeSlash bool) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,111 @@
+package watcher
+
+const (
+	SARIFSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	SARIFVersion = "2.1.0"
+)
+
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+
+	sarifLocation struct {
+		LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+	}
+
+	sarifLogicalLocation struct {
+		Name               string `json:"name"`
+		FullyQualifiedName string `json:"fullyQualifiedName"`
+		Kind               string `json:"kind"`
+	}
+)
+
+var (
+	// sarif rules and levels for the reported states
+	sarifRules = map[string]struct {
+		rule  sarifRule
+		level string
+	}{
+		StateMissing: {
+			sarifRule{ID: "missing-backup", ShortDescription: sarifMessage{Text: "PVC has no backup configuration"}},
+			"error",
+		},
+		StateUnmounted: {
+			sarifRule{ID: "unmounted-volume", ShortDescription: sarifMessage{Text: "PVC is backed up but not mounted by any container"}},
+			"warning",
+		},
+	}
+)
+
+// newSARIF converts the missing and unmounted PVCs of a report into a SARIF
+// log for code scanning UIs
+func newSARIF(report Report) sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "velero-pvc-watcher",
+			InformationURI: "https://github.com/bitsbeats/velero-pvc-watcher",
+			Rules: []sarifRule{
+				sarifRules[StateMissing].rule,
+				sarifRules[StateUnmounted].rule,
+			},
+		}},
+		Results: []sarifResult{},
+	}
+	for _, entry := range report.PVCs {
+		rule, ok := sarifRules[entry.State]
+		if !ok {
+			continue
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  rule.rule.ID,
+			Level:   rule.level,
+			Message: sarifMessage{Text: entry.Namespace + "/" + entry.PVCName + ": " + entry.Reason},
+			Locations: []sarifLocation{{
+				LogicalLocations: []sarifLogicalLocation{{
+					Name:               entry.PVCName,
+					FullyQualifiedName: entry.Namespace + "/" + entry.PVCName,
+					Kind:               "resource",
+				}},
+			}},
+		})
+	}
+	return sarifLog{
+		Schema:  SARIFSchema,
+		Version: SARIFVersion,
+		Runs:    []sarifRun{run},
+	}
+}
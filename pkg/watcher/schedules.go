@@ -0,0 +1,102 @@
+package watcher
+
+import (
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	ScheduleResource = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "schedules"}
+)
+
+// listSchedules lists all velero schedules
+func (v *veleroInformers) listSchedules() []*unstructured.Unstructured {
+	schedules := []*unstructured.Unstructured{}
+	objs, err := v.scheduleInformer.Lister().ByNamespace(v.namespace).List(labels.Everything())
+	if err != nil {
+		return schedules
+	}
+	for _, obj := range objs {
+		if schedule, ok := obj.(*unstructured.Unstructured); ok {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules
+}
+
+// scheduleCovers checks if the backup template of a schedule includes a namespace
+func scheduleCovers(schedule *unstructured.Unstructured, namespace string) bool {
+	return specCovers(schedule, namespace, "spec", "template")
+}
+
+// specCovers checks if the backup spec at fields of obj includes a namespace
+func specCovers(obj *unstructured.Unstructured, namespace string, fields ...string) bool {
+	excluded, _, _ := unstructured.NestedStringSlice(obj.Object, append(fields, "excludedNamespaces")...)
+	if matchesNamespace(excluded, namespace) {
+		return false
+	}
+	included, _, _ := unstructured.NestedStringSlice(obj.Object, append(fields, "includedNamespaces")...)
+	return len(included) == 0 || matchesNamespace(included, namespace)
+}
+
+func matchesNamespace(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// serverDefaultsToFsBackup checks if the velero server backs up all pod
+// volumes by default
+func (v *veleroInformers) serverDefaultsToFsBackup() bool {
+	deploy, err := v.deployLister.Deployments(v.namespace).Get(VeleroDeployment)
+	if err != nil {
+		return false
+	}
+	for _, container := range deploy.Spec.Template.Spec.Containers {
+		if container.Name != VeleroDeployment {
+			continue
+		}
+		for _, arg := range container.Args {
+			switch strings.TrimSuffix(arg, "=true") {
+			case "--default-volumes-to-fs-backup", "--default-volumes-to-restic":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// defaultsToFsBackup resolves if a namespace is in opt-out mode, meaning any
+// schedule covering it backs up all pod volumes unless they are excluded
+func (v *veleroInformers) defaultsToFsBackup(namespace string) bool {
+	serverDefault := v.serverDefaultsToFsBackup()
+	for _, schedule := range v.listSchedules() {
+		if !scheduleCovers(schedule, namespace) {
+			continue
+		}
+		template := []string{"spec", "template"}
+		if enabled, ok, _ := unstructured.NestedBool(schedule.Object, append(template, "defaultVolumesToFsBackup")...); ok {
+			if enabled {
+				return true
+			}
+			continue
+		}
+		if enabled, ok, _ := unstructured.NestedBool(schedule.Object, append(template, "defaultVolumesToRestic")...); ok {
+			if enabled {
+				return true
+			}
+			continue
+		}
+		if serverDefault {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// Permission is a resource the watcher needs to list and watch, an
+	// empty Namespace means cluster wide
+	Permission struct {
+		Group     string
+		Resource  string
+		Namespace string
+	}
+
+	// CheckResult is the outcome of a single self test check
+	CheckResult struct {
+		Name    string `json:"name"`
+		Passed  bool   `json:"passed"`
+		Message string `json:"message,omitempty"`
+	}
+
+	// SelfTestReport summarizes all self test checks
+	SelfTestReport struct {
+		Passed bool          `json:"passed"`
+		Checks []CheckResult `json:"checks"`
+	}
+)
+
+const (
+	permissionDenied = "permission denied"
+)
+
+var (
+	// verbs required on all watched resources
+	requiredVerbs = []string{"list", "watch"}
+)
+
+// RequiredPermissions lists the resources the watcher reads
+func (w *Watcher) RequiredPermissions() []Permission {
+	permissions := []Permission{
+		{"", "pods", ""},
+		{"", "persistentvolumeclaims", ""},
+		{"", "namespaces", ""},
+		{"apps", "statefulsets", ""},
+		{"apps", "replicasets", ""},
+		{"apps", "deployments", ""},
+	}
+	if w.cronJobInformer != nil {
+		permissions = append(permissions, Permission{"batch", "cronjobs", ""})
+	}
+	if w.nodeInformer != nil {
+		permissions = append(permissions, Permission{"", "nodes", ""})
+	}
+	if w.velero != nil {
+		permissions = append(permissions,
+			Permission{BackupResource.Group, BackupResource.Resource, w.velero.namespace},
+			Permission{ScheduleResource.Group, ScheduleResource.Resource, w.velero.namespace},
+			Permission{VolumeSnapshotClassResource.Group, VolumeSnapshotClassResource.Resource, ""},
+			Permission{"storage.k8s.io", "storageclasses", ""},
+		)
+	}
+	return permissions
+}
+
+// CheckPermissions verifies the required verbs on all permissions using
+// SelfSubjectAccessReviews
+func CheckPermissions(ctx context.Context, client kubernetes.Interface, permissions []Permission) []CheckResult {
+	results := []CheckResult{}
+	for _, permission := range permissions {
+		for _, verb := range requiredVerbs {
+			results = append(results, checkPermission(ctx, client, permission, verb))
+		}
+	}
+	return results
+}
+
+func checkPermission(ctx context.Context, client kubernetes.Interface, permission Permission, verb string) CheckResult {
+	result := CheckResult{Name: fmt.Sprintf("rbac %s %s", verb, permission)}
+	review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: permission.Namespace,
+				Verb:      verb,
+				Group:     permission.Group,
+				Resource:  permission.Resource,
+			},
+		},
+	}, metav1.CreateOptions{})
+	switch {
+	case err != nil:
+		result.Message = err.Error()
+	case !review.Status.Allowed:
+		result.Message = permissionDenied
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// ValidatePermissions checks all required permissions on startup, logs the
+// missing ones and exports them as permission gap metric
+func (w *Watcher) ValidatePermissions(ctx context.Context, client kubernetes.Interface) bool {
+	valid := true
+	w.promPermissionMissing.Reset()
+	for _, permission := range w.RequiredPermissions() {
+		for _, verb := range requiredVerbs {
+			result := checkPermission(ctx, client, permission, verb)
+			missing := 0.0
+			if !result.Passed {
+				valid = false
+				missing = 1
+				log.Printf("missing permission to %s %s: %s", verb, permission, result.Message)
+			}
+			w.promPermissionMissing.With(prometheus.Labels{
+				"group":     permission.Group,
+				"resource":  permission.Resource,
+				"namespace": permission.Namespace,
+				"verb":      verb,
+			}).Set(missing)
+		}
+	}
+	return valid
+}
+
+// String formats a permission like group/resource in namespace
+func (p Permission) String() string {
+	s := p.Resource
+	if p.Group != "" {
+		s = p.Resource + "." + p.Group
+	}
+	if p.Namespace != "" {
+		s += " in namespace " + p.Namespace
+	}
+	return s
+}
+
+// SelfTest checks apiserver connectivity, informer sync, RBAC and the
+// presence of the velero CRDs
+func (w *Watcher) SelfTest(ctx context.Context, client kubernetes.Interface) SelfTestReport {
+	checks := []CheckResult{}
+
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		checks = append(checks, CheckResult{Name: "apiserver connectivity", Message: err.Error()})
+	} else {
+		checks = append(checks, CheckResult{Name: "apiserver connectivity", Passed: true, Message: version.GitVersion})
+	}
+
+	syncStatus := w.SyncStatus()
+	names := make([]string, 0, len(syncStatus))
+	for name := range syncStatus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		synced := syncStatus[name]
+		result := CheckResult{Name: "informer " + name, Passed: synced}
+		if !synced {
+			result.Message = "cache not synced"
+		}
+		checks = append(checks, result)
+	}
+
+	checks = append(checks, CheckPermissions(ctx, client, w.RequiredPermissions())...)
+
+	crds := CheckResult{Name: "velero crds"}
+	resources, err := client.Discovery().ServerResourcesForGroupVersion(BackupResource.GroupVersion().String())
+	switch {
+	case err != nil && w.velero == nil:
+		crds.Passed = true
+		crds.Message = "not installed, velero crds are disabled"
+	case err != nil:
+		crds.Message = err.Error()
+	default:
+		found := map[string]bool{}
+		for _, resource := range resources.APIResources {
+			found[resource.Name] = true
+		}
+		crds.Passed = found[BackupResource.Resource] && found[ScheduleResource.Resource]
+		if !crds.Passed {
+			crds.Message = "backups or schedules missing"
+		}
+	}
+	checks = append(checks, crds)
+
+	report := SelfTestReport{Passed: true, Checks: checks}
+	for _, check := range checks {
+		if !check.Passed {
+			report.Passed = false
+		}
+	}
+	return report
+}
+
+// SelfTestHandler serves the self test report, failing with 503
+func (w *Watcher) SelfTestHandler(client kubernetes.Interface) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		report := w.SelfTest(ctx, client)
+		status := http.StatusOK
+		if !report.Passed {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(rw, status, report)
+	}
+}
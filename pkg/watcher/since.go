@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// recordAnnotationChange remembers when the backup annotations of a PVC or
+// of a pod using it changed
+func (w *Watcher) recordAnnotationChange(namespace string, pvcNames ...string) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	now := time.Now()
+	for _, name := range pvcNames {
+		w.annotationChanged[PVCInfo{Namespace: namespace, PVCName: name}] = now
+	}
+}
+
+// unprotectedSince derives when a PVC became unprotected from the objects
+// instead of the start of the watcher: the PVC has been unprotected at
+// least since it was created, since the oldest pod using it was created
+// (template annotation changes roll the pods) and since an observed
+// annotation change, whichever is latest
+func (w *Watcher) unprotectedSince(pvc *v1.PersistentVolumeClaim) time.Time {
+	since := pvc.GetCreationTimestamp().Time
+	pods, err := w.podsForPVCs(pvc.GetNamespace(), []*v1.PersistentVolumeClaim{pvc})
+	if err == nil && len(pods) > 0 {
+		oldest := pods[0].GetCreationTimestamp().Time
+		for _, pod := range pods[1:] {
+			if created := pod.GetCreationTimestamp().Time; created.Before(oldest) {
+				oldest = created
+			}
+		}
+		if oldest.After(since) {
+			since = oldest
+		}
+	}
+	w.stateMu.Lock()
+	changed := w.annotationChanged[PVCInfo{Namespace: pvc.GetNamespace(), PVCName: pvc.GetName()}]
+	w.stateMu.Unlock()
+	if changed.After(since) {
+		since = changed
+	}
+	return since
+}
+
+// claimNames lists the PVCs a pod references, generic ephemeral volumes
+// included
+func claimNames(pod *v1.Pod) []string {
+	names := []string{}
+	for _, volume := range pod.Spec.Volumes {
+		if pvcName, ok := claimName(pod, volume); ok {
+			names = append(names, pvcName)
+		}
+	}
+	return names
+}
@@ -0,0 +1,111 @@
+package watcher
+
+import (
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type (
+	// StateDump is a snapshot of the internal state for debugging
+	StateDump struct {
+		Time       time.Time       `json:"time"`
+		Ready      bool            `json:"ready"`
+		SyncStatus map[string]bool `json:"sync_status"`
+		PVCs       []PVCState      `json:"pvcs"`
+	}
+
+	// PVCState is the last evaluated state of a PVC
+	PVCState struct {
+		Namespace string `json:"namespace"`
+		PVCName   string `json:"pvc_name"`
+		State     string `json:"state"`
+	}
+)
+
+// DumpState returns the sync status and the last evaluated PVC states
+func (w *Watcher) DumpState() StateDump {
+	dump := StateDump{
+		Time:       time.Now(),
+		Ready:      w.Ready(),
+		SyncStatus: w.SyncStatus(),
+		PVCs:       []PVCState{},
+	}
+	w.stateMu.Lock()
+	for info, state := range w.lastStates {
+		dump.PVCs = append(dump.PVCs, PVCState{
+			Namespace: info.Namespace,
+			PVCName:   info.PVCName,
+			State:     state,
+		})
+	}
+	w.stateMu.Unlock()
+	sort.Slice(dump.PVCs, func(i, j int) bool {
+		if dump.PVCs[i].Namespace != dump.PVCs[j].Namespace {
+			return dump.PVCs[i].Namespace < dump.PVCs[j].Namespace
+		}
+		return dump.PVCs[i].PVCName < dump.PVCs[j].PVCName
+	})
+	return dump
+}
+
+type (
+	// NamespaceDebug is the evaluation model of a namespace, Volumes
+	// categorizes every volume of all pods in the namespace
+	NamespaceDebug struct {
+		Namespace string        `json:"namespace"`
+		Pods      []string      `json:"pods"`
+		Volumes   []VolumeDebug `json:"volumes"`
+		PVCs      []PVCDebug    `json:"pvcs"`
+	}
+
+	// PVCDebug explains the classification of a PVC
+	PVCDebug struct {
+		PVCName string `json:"pvc_name"`
+		State   string `json:"state"`
+		Method  string `json:"method"`
+		Reason  string `json:"reason"`
+	}
+)
+
+// DebugState evaluates all namespaces like EvaluateAll and returns the evaluated pods, how
+// the volumes of all pods were categorized and the reason of each PVC classification
+func (w *Watcher) DebugState() []NamespaceDebug {
+	result := []NamespaceDebug{}
+	nsList, _ := w.ListNamespaces()
+	for _, namespace := range nsList {
+		if w.isExcludedNamespace(namespace.GetName()) || isTerminating(namespace) {
+			continue
+		}
+		statuses, pods := w.evaluate(namespace.GetName())
+		debug := NamespaceDebug{
+			Namespace: namespace.GetName(),
+			Pods:      pods,
+			Volumes:   []VolumeDebug{},
+			PVCs:      []PVCDebug{},
+		}
+		nsPods, _ := w.podInformer.Lister().Pods(namespace.GetName()).List(labels.Everything())
+		sort.Slice(nsPods, func(i, j int) bool {
+			return nsPods[i].GetName() < nsPods[j].GetName()
+		})
+		for _, pod := range nsPods {
+			for _, volume := range pod.Spec.Volumes {
+				debug.Volumes = append(debug.Volumes, classifyVolume(pod, volume))
+			}
+		}
+		for _, status := range statuses {
+			debug.PVCs = append(debug.PVCs, PVCDebug{
+				PVCName: status.PVCName,
+				State:   status.State,
+				Method:  status.Method,
+				Reason:  status.Reason,
+			})
+		}
+		result = append(result, debug)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result
+}
@@ -0,0 +1,57 @@
+package watcher
+
+import (
+	"time"
+)
+
+type (
+	// Summary is the coverage summary of an evaluation
+	Summary struct {
+		Time       time.Time                   `json:"time"`
+		Total      int                         `json:"total"`
+		States     map[string]int              `json:"states"`
+		Coverage   float64                     `json:"coverage"`
+		Namespaces map[string]NamespaceSummary `json:"namespaces"`
+	}
+
+	// NamespaceSummary is the coverage summary of a single namespace
+	NamespaceSummary struct {
+		Total    int            `json:"total"`
+		States   map[string]int `json:"states"`
+		Coverage float64        `json:"coverage"`
+	}
+)
+
+// Summarize counts the states of all PVCs, coverage is the ratio of PVCs
+// that are not missing
+func Summarize(t time.Time, statuses []PVCStatus) Summary {
+	summary := Summary{
+		Time:       t,
+		States:     map[string]int{},
+		Namespaces: map[string]NamespaceSummary{},
+	}
+	for _, status := range statuses {
+		ns, ok := summary.Namespaces[status.Namespace]
+		if !ok {
+			ns.States = map[string]int{}
+		}
+		ns.Total++
+		ns.States[status.State]++
+		summary.Namespaces[status.Namespace] = ns
+		summary.Total++
+		summary.States[status.State]++
+	}
+	for name, ns := range summary.Namespaces {
+		ns.Coverage = coverage(ns.Total, ns.States[StateMissing])
+		summary.Namespaces[name] = ns
+	}
+	summary.Coverage = coverage(summary.Total, summary.States[StateMissing])
+	return summary
+}
+
+func coverage(total, missing int) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(total-missing) / float64(total)
+}
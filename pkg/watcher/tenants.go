@@ -0,0 +1,86 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+type (
+	// TenantMapping assigns namespaces to the tenants of a shared cluster
+	TenantMapping struct {
+		Tenants map[string]Tenant `json:"tenants"`
+	}
+
+	// Tenant is a customer with its own velero BackupStorageLocation
+	Tenant struct {
+		StorageLocation string `json:"storageLocation"`
+		// Namespaces are names or shell patterns like acme-*
+		Namespaces []string `json:"namespaces"`
+	}
+)
+
+// LoadTenantMapping reads a tenant mapping from a yaml or json file
+func LoadTenantMapping(file string) (*TenantMapping, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read tenant mapping: %w", err)
+	}
+	mapping := &TenantMapping{}
+	if err := yaml.UnmarshalStrict(data, mapping); err != nil {
+		return nil, fmt.Errorf("unable to parse tenant mapping: %w", err)
+	}
+	for name, tenant := range mapping.Tenants {
+		for _, pattern := range tenant.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid namespace pattern %q of tenant %s: %w", pattern, name, err)
+			}
+		}
+	}
+	return mapping, nil
+}
+
+// Lookup returns the tenant and storage location of a namespace, a namespace
+// matched by several tenants belongs to the first by name, empty if none
+func (m *TenantMapping) Lookup(namespace string) (string, string) {
+	names := make([]string, 0, len(m.Tenants))
+	for name := range m.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, pattern := range m.Tenants[name].Namespaces {
+			if ok, _ := path.Match(pattern, namespace); ok {
+				return name, m.Tenants[name].StorageLocation
+			}
+		}
+	}
+	return "", ""
+}
+
+// collectTenants exports the PVCs per state and the coverage of each tenant
+func (w *Watcher) collectTenants(statuses []PVCStatus) {
+	w.promTenantPVCs.Reset()
+	w.promTenantCoverage.Reset()
+	if w.config.Tenants == nil {
+		return
+	}
+	type key struct{ tenant, location string }
+	byTenant := map[key][]PVCStatus{}
+	for _, status := range statuses {
+		tenant, location := w.config.Tenants.Lookup(status.Namespace)
+		k := key{tenant, location}
+		byTenant[k] = append(byTenant[k], status)
+	}
+	for k, tenantStatuses := range byTenant {
+		summary := Summarize(time.Now(), tenantStatuses)
+		for state, count := range summary.States {
+			w.promTenantPVCs.WithLabelValues(k.tenant, k.location, state).Set(float64(count))
+		}
+		w.promTenantCoverage.WithLabelValues(k.tenant, k.location).Set(summary.Coverage)
+	}
+}
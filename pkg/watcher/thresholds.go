@@ -0,0 +1,84 @@
+package watcher
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Threshold is a failure condition on the summary of an evaluation, e.g.
+	// missing>0 or coverage<95%
+	Threshold struct {
+		Metric   string
+		Operator string
+		Value    float64
+		raw      string
+	}
+)
+
+var (
+	thresholdExpr = regexp.MustCompile(`^\s*([a-z]+)\s*(>=|<=|==|!=|>|<)\s*([0-9.]+)(%?)\s*$`)
+)
+
+// ParseThreshold parses an expression of the form <metric><operator><value>,
+// metric is total, coverage or one of the PVC states, percentages are only
+// allowed for coverage
+func ParseThreshold(s string) (Threshold, error) {
+	m := thresholdExpr.FindStringSubmatch(s)
+	if m == nil {
+		return Threshold{}, fmt.Errorf("expected <metric><operator><value>, got %q", s)
+	}
+	threshold := Threshold{Metric: m[1], Operator: m[2], raw: strings.TrimSpace(s)}
+	value, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return Threshold{}, fmt.Errorf("invalid value in %q: %w", s, err)
+	}
+	switch threshold.Metric {
+	case "coverage":
+		if m[4] == "%" || value > 1 {
+			value /= 100
+		}
+	case "total", StateProtected, StateExcluded, StateMissing, StateUnmanaged, StateUnmounted:
+		if m[4] == "%" {
+			return Threshold{}, fmt.Errorf("percentages are only supported for coverage, got %q", s)
+		}
+	default:
+		return Threshold{}, fmt.Errorf("unknown metric %q in %q", threshold.Metric, s)
+	}
+	threshold.Value = value
+	return threshold, nil
+}
+
+// Exceeded reports whether the summary matches the failure condition
+func (t Threshold) Exceeded(summary Summary) bool {
+	var actual float64
+	switch t.Metric {
+	case "coverage":
+		actual = summary.Coverage
+	case "total":
+		actual = float64(summary.Total)
+	default:
+		actual = float64(summary.States[t.Metric])
+	}
+	switch t.Operator {
+	case ">":
+		return actual > t.Value
+	case ">=":
+		return actual >= t.Value
+	case "<":
+		return actual < t.Value
+	case "<=":
+		return actual <= t.Value
+	case "==":
+		return actual == t.Value
+	case "!=":
+		return actual != t.Value
+	}
+	return false
+}
+
+func (t Threshold) String() string {
+	return t.raw
+}
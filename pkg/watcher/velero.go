@@ -0,0 +1,205 @@
+package watcher
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	storageinformers "k8s.io/client-go/informers/storage/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	BackupResource              = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "backups"}
+	VolumeSnapshotClassResource = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotclasses"}
+)
+
+type (
+	// veleroInformers watches the velero custom resources
+	veleroInformers struct {
+		namespace        string
+		backupInformer   *crdInformer
+		scheduleInformer *crdInformer
+		vscInformer      *crdInformer
+		deployLister     appslisters.DeploymentLister
+		scInformer       storageinformers.StorageClassInformer
+
+		promCRDAvailable         *prometheus.GaugeVec
+		promBackupItemOperations *prometheus.GaugeVec
+		promScheduleNamespaces   *prometheus.GaugeVec
+		promSchedulePVCs         *prometheus.GaugeVec
+		promLastBackup           *prometheus.GaugeVec
+	}
+)
+
+// EnableVelero enables watching the velero custom resources of the velero
+// installation in namespace, it has to be called before Run. The custom
+// resources are only watched while their CRDs are installed.
+func (w *Watcher) EnableVelero(client dynamic.Interface, discovery discovery.DiscoveryInterface, namespace string) {
+	w.velero = &veleroInformers{
+		namespace:        namespace,
+		backupInformer:   newCRDInformer("velero backups", BackupResource, client, discovery),
+		scheduleInformer: newCRDInformer("velero schedules", ScheduleResource, client, discovery),
+		vscInformer:      newCRDInformer("volume snapshot classes", VolumeSnapshotClassResource, client, discovery),
+		deployLister:     w.deployInformer.Lister(),
+		scInformer:       w.factory.Storage().V1().StorageClasses(),
+		promCRDAvailable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "backupmonitor_crd_available",
+			Help: "1 if the CRD of a watched custom resource is installed, probed with backoff while missing",
+		}, []string{
+			"resource",
+		}),
+		promBackupItemOperations: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "backupmonitor_backup_item_operations",
+			Help: "Asynchronous backup item operations of a backup by state",
+		}, []string{
+			"backup",
+			"namespace",
+			"state",
+		}),
+		promScheduleNamespaces: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "backupmonitor_schedule_namespaces",
+			Help: "PVC-bearing namespaces covered by a schedule, state total or complete (no missing backups)",
+		}, []string{
+			"schedule",
+			"state",
+		}),
+		promSchedulePVCs: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "backupmonitor_schedule_pvcs",
+			Help: "PVCs covered by a schedule, state total or handled (protected or excluded)",
+		}, []string{
+			"schedule",
+			"state",
+		}),
+		promLastBackup: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "backupmonitor_last_backup_info",
+			Help: "Most recent completed velero backup covering a protected PVC, always 1",
+		}, []string{
+			"namespace",
+			"pvc_name",
+			"backup",
+		}),
+	}
+}
+
+// namedInformers lists the storage class informer and the custom resource
+// informers whose CRDs are installed
+func (v *veleroInformers) namedInformers() []namedInformer {
+	named := []namedInformer{}
+	for _, crd := range v.crdInformers() {
+		named = append(named, crd.namedInformers()...)
+	}
+	return append(named, namedInformer{"storage classes", v.scInformer.Informer()})
+}
+
+func (v *veleroInformers) crdInformers() []*crdInformer {
+	return []*crdInformer{v.backupInformer, v.scheduleInformer, v.vscInformer}
+}
+
+// runCRDs starts the custom resource informers whose CRDs are installed and
+// waits for them to sync, missing CRDs are probed in the background
+func (v *veleroInformers) runCRDs(stopper chan struct{}, onStart func(namedInformer)) {
+	for _, crd := range v.crdInformers() {
+		crd.onStart = onStart
+		crd.run(stopper)
+	}
+}
+
+func (v *veleroInformers) describe(ch chan<- *prometheus.Desc) {
+	v.promCRDAvailable.Describe(ch)
+	v.promBackupItemOperations.Describe(ch)
+	v.promScheduleNamespaces.Describe(ch)
+	v.promSchedulePVCs.Describe(ch)
+	v.promLastBackup.Describe(ch)
+}
+
+func (v *veleroInformers) collect(ch chan<- prometheus.Metric, statuses []PVCStatus) {
+	for _, crd := range v.crdInformers() {
+		v.promCRDAvailable.WithLabelValues(crd.resource.GroupResource().String()).Set(boolValue(crd.Available()))
+	}
+	v.promCRDAvailable.Collect(ch)
+	v.collectScheduleCoverage(statuses)
+	v.promScheduleNamespaces.Collect(ch)
+	v.promSchedulePVCs.Collect(ch)
+	v.collectLastBackups(statuses)
+	v.promLastBackup.Collect(ch)
+
+	v.collectItemOperations()
+	v.promBackupItemOperations.Collect(ch)
+}
+
+// collectItemOperations exports the asynchronous item operations of the
+// latest backup of each schedule, backups without schedule count as one
+// schedule. Operations are only in progress while the backup waits for them.
+func (v *veleroInformers) collectItemOperations() {
+	v.promBackupItemOperations.Reset()
+
+	latest := map[string]*unstructured.Unstructured{}
+	for _, backup := range v.listBackups() {
+		schedule := backup.GetLabels()[BackupScheduleLabel]
+		last, ok := latest[schedule]
+		if ok && !backup.GetCreationTimestamp().After(last.GetCreationTimestamp().Time) {
+			continue
+		}
+		latest[schedule] = backup
+	}
+	for _, backup := range latest {
+		attempted, _, _ := unstructured.NestedInt64(backup.Object, "status", "backupItemOperationsAttempted")
+		completed, _, _ := unstructured.NestedInt64(backup.Object, "status", "backupItemOperationsCompleted")
+		failed, _, _ := unstructured.NestedInt64(backup.Object, "status", "backupItemOperationsFailed")
+		if attempted == 0 {
+			continue
+		}
+		inProgress := int64(0)
+		switch phase, _, _ := unstructured.NestedString(backup.Object, "status", "phase"); phase {
+		case BackupPhaseInProgress, BackupPhaseWaitingForPluginOperations, BackupPhaseWaitingForPluginOperationsPartiallyFailed:
+			inProgress = attempted - completed - failed
+		}
+		namespaces, _, _ := unstructured.NestedStringSlice(backup.Object, "spec", "includedNamespaces")
+		if len(namespaces) == 0 {
+			namespaces = []string{"*"}
+		}
+		for _, namespace := range namespaces {
+			v.promBackupItemOperations.WithLabelValues(backup.GetName(), namespace, "in_progress").Set(float64(inProgress))
+			v.promBackupItemOperations.WithLabelValues(backup.GetName(), namespace, "failed").Set(float64(failed))
+		}
+	}
+}
+
+// collectScheduleCoverage counts the namespaces and PVCs each schedule covers
+func (v *veleroInformers) collectScheduleCoverage(statuses []PVCStatus) {
+	v.promScheduleNamespaces.Reset()
+	v.promSchedulePVCs.Reset()
+
+	byNamespace := map[string][]PVCStatus{}
+	for _, status := range statuses {
+		byNamespace[status.Namespace] = append(byNamespace[status.Namespace], status)
+	}
+	for _, schedule := range v.listSchedules() {
+		namespaces, complete, pvcs, handled := 0, 0, 0, 0
+		for namespace, nsStatuses := range byNamespace {
+			if !scheduleCovers(schedule, namespace) {
+				continue
+			}
+			namespaces++
+			nsHandled := 0
+			for _, status := range nsStatuses {
+				if status.State != StateMissing {
+					nsHandled++
+				}
+			}
+			if nsHandled == len(nsStatuses) {
+				complete++
+			}
+			pvcs += len(nsStatuses)
+			handled += nsHandled
+		}
+		name := schedule.GetName()
+		v.promScheduleNamespaces.WithLabelValues(name, "total").Set(float64(namespaces))
+		v.promScheduleNamespaces.WithLabelValues(name, "complete").Set(float64(complete))
+		v.promSchedulePVCs.WithLabelValues(name, "total").Set(float64(pvcs))
+		v.promSchedulePVCs.WithLabelValues(name, "handled").Set(float64(handled))
+	}
+}
@@ -0,0 +1,53 @@
+package watcher
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+)
+
+var (
+	// VirtualNodeLabels identify virtual-kubelet nodes, e.g. ACI virtual
+	// nodes, and EKS Fargate nodes
+	VirtualNodeLabels = map[string]string{
+		"type":                           "virtual-kubelet",
+		"eks.amazonaws.com/compute-type": "fargate",
+	}
+)
+
+// virtualNode returns the name of the node a pod is scheduled on if it is a
+// virtual node, unknown nodes are treated as regular nodes
+func (w *Watcher) virtualNode(pod *v1.Pod) (string, bool) {
+	if w.nodeInformer == nil || pod.Spec.NodeName == "" {
+		return "", false
+	}
+	node, err := w.nodeInformer.Lister().Get(pod.Spec.NodeName)
+	if err != nil {
+		return "", false
+	}
+	for key, value := range VirtualNodeLabels {
+		if node.GetLabels()[key] == value {
+			return node.GetName(), true
+		}
+	}
+	return "", false
+}
+
+// listVirtualPodHandledPVCs resolves the PVCs of a pod on a virtual node
+// like listPodHandledPVCs, but reports volumes relying on fs-backup as
+// missing since no node-agent can back them up
+func listVirtualPodHandledPVCs(pod *v1.Pod, node string, optOut, requireMounted, initOnlyExcluded bool, handledPvcNames *map[string]interface{}) {
+	podPVCs := map[string]interface{}{}
+	listPodHandledPVCs(pod, optOut, requireMounted, initOnlyExcluded, &podPVCs)
+	for pvcName, h := range podPVCs {
+		h := h.(handling)
+		if h.State == StateProtected || h.State == StateUnmounted {
+			h = handling{
+				State:         StateMissing,
+				Reason:        fmt.Sprintf("%s, but it runs on virtual node %s without velero node-agent", h.Reason, node),
+				MissingReason: ReasonNoNodeAgent,
+			}
+		}
+		setHandling(handledPvcNames, pvcName, h)
+	}
+}
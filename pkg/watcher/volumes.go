@@ -0,0 +1,70 @@
+package watcher
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+const (
+	VolumeEvaluated = "evaluated"
+	VolumeIgnored   = "ignored"
+)
+
+type (
+	// VolumeDebug explains how a volume of an evaluated pod was categorized
+	VolumeDebug struct {
+		Pod            string `json:"pod"`
+		Volume         string `json:"volume"`
+		Type           string `json:"type"`
+		Classification string `json:"classification"`
+		Reason         string `json:"reason"`
+	}
+)
+
+// classifyVolume returns the type of a pod volume, if it is evaluated and
+// why, only PVCs and generic ephemeral volumes are backed by PVCs, they are
+// resolved by claimName like in the evaluation
+func classifyVolume(pod *v1.Pod, volume v1.Volume) VolumeDebug {
+	debug := VolumeDebug{
+		Pod:            pod.GetName(),
+		Volume:         volume.Name,
+		Classification: VolumeIgnored,
+	}
+	source := volume.VolumeSource
+	if pvcName, ok := claimName(pod, volume); ok {
+		debug.Type = "persistentVolumeClaim"
+		debug.Reason = "pvc " + pvcName
+		if source.Ephemeral != nil {
+			debug.Type = "ephemeral"
+			debug.Reason += " created for the pod"
+		}
+		debug.Classification = VolumeEvaluated
+		return debug
+	}
+	switch {
+	case source.EmptyDir != nil:
+		debug.Type = "emptyDir"
+		debug.Reason = "scratch space deleted with the pod"
+	case source.ConfigMap != nil:
+		debug.Type = "configMap"
+		debug.Reason = "content of configmap " + source.ConfigMap.Name + ", velero backs up the object"
+	case source.Secret != nil:
+		debug.Type = "secret"
+		debug.Reason = "content of secret " + source.Secret.SecretName + ", velero backs up the object"
+	case source.Projected != nil:
+		debug.Type = "projected"
+		debug.Reason = "generated from service account tokens, configmaps, secrets or the downward api"
+	case source.DownwardAPI != nil:
+		debug.Type = "downwardAPI"
+		debug.Reason = "generated from pod fields"
+	case source.CSI != nil:
+		debug.Type = "csi"
+		debug.Reason = "inline volume of driver " + source.CSI.Driver + " without a PVC, neither fs-backup nor csi snapshots are evaluated"
+	case source.HostPath != nil:
+		debug.Type = "hostPath"
+		debug.Reason = "node local path, not part of the cluster state"
+	default:
+		debug.Type = "other"
+		debug.Reason = "in-tree volume without a PVC"
+	}
+	return debug
+}
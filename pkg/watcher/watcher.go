@@ -0,0 +1,932 @@
+package watcher
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// Config holds the evaluation settings of a Watcher
+	Config struct {
+		// ExcludeNamespaces skips all namespaces matching the expression
+		ExcludeNamespaces *regexp.Regexp
+		// ExcludePods treats the PVCs of all matching pods as excluded
+		ExcludePods labels.Selector
+		// PVCProtected and PVCExcluded map PVC annotations or labels
+		// (key -> value) to a protected or excluded state
+		PVCProtected map[string]string
+		PVCExcluded  map[string]string
+		// OwnerKinds limits the evaluation to pods of these top level
+		// owner kinds (e.g. Deployment, StatefulSet or Pod for bare pods),
+		// all kinds are evaluated if empty
+		OwnerKinds map[string]struct{}
+		// RequireMounted reports backed up PVC volumes that are declared
+		// but not mounted by any container as unmounted
+		RequireMounted bool
+		// InitOnlyExcluded excludes PVCs without backup configuration that
+		// are only mounted by init containers, e.g. migration volumes
+		InitOnlyExcluded bool
+		// NamespaceLabels are copied from the namespace onto the exported
+		// series as namespace_label_<name>
+		NamespaceLabels []string
+		// PVCLabels are copied from the PVC onto the per PVC series as
+		// label_<name>
+		PVCLabels []string
+		// StorageClassPrices maps storage classes to a monthly price per GiB
+		// used to estimate the cost of unprotected data
+		StorageClassPrices map[string]float64
+		// EvaluationWorkers is the number of namespaces evaluated in parallel
+		EvaluationWorkers int
+		// LowMemory caches only the pod fields needed for evaluation
+		LowMemory bool
+		// InspectCronJobs evaluates the pod templates of CronJobs like pods
+		InspectCronJobs bool
+		// Features toggles features per cluster
+		Features FeatureGates
+		// Rules override the classification of matching PVCs, the first
+		// matching rule wins
+		Rules []Rule
+		// OnboardingWindow is the age up to which namespaces are checked
+		// for backups once they are older than OnboardingGrace, disabled
+		// if 0
+		OnboardingWindow time.Duration
+		OnboardingGrace  time.Duration
+		// SnapshotProvisioners are the provisioners the installed velero
+		// plugins can snapshot, missing PVCs of other provisioners are
+		// reported with ReasonNoSnapshotSupport, unchecked if empty
+		SnapshotProvisioners map[string]struct{}
+		// VirtualNodes reports fs-backup configured PVCs of pods on nodes
+		// with VirtualNodeLabels as missing, with VirtualNodesCSI they are
+		// protected if their storage class supports csi snapshots
+		VirtualNodes    bool
+		VirtualNodesCSI bool
+		// ExcludeDataSources excludes missing PVCs provisioned from a
+		// VolumeSnapshot or cloned from a PVC, e.g. restore drills, unless
+		// they are annotated with EvaluateDataSourceAnnotation
+		ExcludeDataSources bool
+		// StaleBackupAge flags protected PVCs of namespaces without a
+		// completed velero backup within the age as at risk, disabled if 0
+		StaleBackupAge time.Duration
+		// Tenants adds the tenant of the namespace as label to the per
+		// namespace and per PVC series and enables per tenant aggregates
+		Tenants *TenantMapping
+		// EvaluationCache is the time a full evaluation is reused, e.g.
+		// for scrapes of several Prometheus replicas at the same time
+		EvaluationCache time.Duration
+		// EvaluationJitter is the maximum random delay of periodic
+		// evaluations like remote-write pushes
+		EvaluationJitter time.Duration
+		// ReadOnly is exported as backupmonitor_read_only_mode, the
+		// features writing to the cluster must not be enabled with it
+		ReadOnly bool
+	}
+
+	Watcher struct {
+		config      Config
+		factory     informers.SharedInformerFactory
+		podInformer coreinformers.PodInformer
+		pvcInformer coreinformers.PersistentVolumeClaimInformer
+		nsInformer  coreinformers.NamespaceInformer
+
+		stsInformer     appsinformers.StatefulSetInformer
+		rsInformer      appsinformers.ReplicaSetInformer
+		deployInformer  appsinformers.DeploymentInformer
+		cronJobInformer batchinformers.CronJobInformer
+		nodeInformer    coreinformers.NodeInformer
+
+		promMissingBackups    *prometheus.GaugeVec
+		promOwnerMissing      *prometheus.GaugeVec
+		promProtected         *prometheus.GaugeVec
+		promPVCStatus         *prometheus.GaugeVec
+		promExcludedVolumes   *prometheus.GaugeVec
+		promAnnotationChanges *prometheus.CounterVec
+		promPermissionMissing *prometheus.GaugeVec
+		promUnmanagedPods     *prometheus.GaugeVec
+		promUnmounted         *prometheus.GaugeVec
+		promAtRisk            *prometheus.GaugeVec
+		promUnprotectedBytes  *prometheus.GaugeVec
+		promUnprotectedCost   *prometheus.GaugeVec
+		promUnprotectedSince  *prometheus.GaugeVec
+		promNotOnboarded      *prometheus.GaugeVec
+		promBackupHooks       *prometheus.GaugeVec
+		promTenantPVCs        *prometheus.GaugeVec
+		promTenantCoverage    *prometheus.GaugeVec
+		promInformerObjects   *prometheus.GaugeVec
+		promInformerLastSync  *prometheus.GaugeVec
+
+		promAPIServerReachable prometheus.Gauge
+		promRequestDuration    *prometheus.HistogramVec
+		promUp                 *prometheus.GaugeVec
+		promReadOnly           prometheus.Gauge
+		promWarmingUp          prometheus.Gauge
+
+		velero  *veleroInformers
+		opa     *opaPolicy
+		reports *reportScheduler
+
+		// time each informer last delivered an event, resyncs included
+		activityMu       sync.Mutex
+		informerActivity map[string]time.Time
+
+		// health of the subsystems by component
+		healthMu sync.Mutex
+		health   map[string]bool
+
+		changes    *ChangeLog
+		history    *History
+		stateMu    sync.Mutex
+		lastStates map[PVCInfo]string
+		// recorded is set after the first evaluation was recorded
+		recorded bool
+		// forgotten counts the calls of forget, evaluations started before
+		// one drop the statuses of PVCs deleted in the meantime
+		forgotten uint64
+		// ready is set to 1 after the first full evaluation on synced caches
+		ready int32
+		// listeners called after each full evaluation
+		listeners []func([]PVCStatus)
+		// time the backup annotations of a PVC or its pods last changed
+		annotationChanged map[PVCInfo]time.Time
+		// namespaces already logged as not onboarded
+		onboardingLogged map[string]bool
+		// evaluationMu guards the running and the last full evaluation,
+		// the last one is reused for Config.EvaluationCache
+		evaluationMu   sync.Mutex
+		evaluation     *evaluationCall
+		lastEvaluation time.Time
+		lastStatuses   []PVCStatus
+		// collectMu serializes collections, so a concurrent scrape does not
+		// reset the gauges being collected
+		collectMu sync.Mutex
+	}
+
+	// evaluationCall is a running full evaluation, concurrent callers wait
+	// for its result instead of evaluating again
+	evaluationCall struct {
+		done     chan struct{}
+		statuses []PVCStatus
+	}
+
+	PVCInfo struct {
+		Namespace string
+		PVCName   string
+	}
+
+	// PVCStatus is the evaluated backup state of a single PVC, Method is the
+	// protection path (fs-backup or csi) that applies
+	PVCStatus struct {
+		PVCInfo
+		State        string
+		Method       string
+		Labels       map[string]string
+		Reason       string
+		StorageClass string
+		// Size is the capacity of the PVC in bytes
+		Size int64
+		// UnprotectedSince is the time a missing PVC became unprotected
+		UnprotectedSince time.Time
+		// Owner is the Kind/name of the top level controller of the first
+		// pod by name using the PVC and Volume the name of the volume in
+		// that pod, both empty if the PVC is unused
+		Owner  string
+		Volume string
+		// MissingReason is the machine readable cause of a missing PVC,
+		// one of MissingReasons, or why a PVC that is not missing is at
+		// risk, one of RiskReasons
+		MissingReason string
+		// Exclusion is the source of an excluded state, one of
+		// ExclusionSources, empty for exclusions by the configuration
+		Exclusion string
+	}
+)
+
+const (
+	StateProtected = "protected"
+	StateExcluded  = "excluded"
+	StateMissing   = "missing"
+	// StateUnmanaged marks PVCs of pods outside the configured owner kinds
+	StateUnmanaged = "unmanaged"
+	// StateUnmounted marks PVCs with a backup configuration that are not
+	// mounted by any container
+	StateUnmounted = "unmounted"
+)
+
+var (
+	// States are all states a PVC can be classified as
+	States = []string{StateProtected, StateExcluded, StateMissing, StateUnmanaged, StateUnmounted}
+)
+
+// NewWatcher creates a new Watcher
+func NewWatcher(factory informers.SharedInformerFactory, config Config) *Watcher {
+	if config.LowMemory {
+		useLowMemoryPodInformer(factory)
+	}
+	podInformer := factory.Core().V1().Pods()
+	err := podInformer.Informer().AddIndexers(cache.Indexers{
+		PodPVCIndex: indexPodByPVC,
+	})
+	if err != nil {
+		log.Printf("unable to add pod indexers: %s", err)
+	}
+	pvcInformer := factory.Core().V1().PersistentVolumeClaims()
+	nsInformer := factory.Core().V1().Namespaces()
+	stsInformer := factory.Apps().V1().StatefulSets()
+	rsInformer := factory.Apps().V1().ReplicaSets()
+	deployInformer := factory.Apps().V1().Deployments()
+
+	nsLabelNames, pvcLabelNames := seriesLabelNames(config)
+
+	promMissingBackups := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_missing",
+		Help: "Unconfigured PXC Backups",
+	}, append(append([]string{}, pvcLabelNames...), "method", "reason"))
+
+	promOwnerMissing := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_owner_missing_volumes",
+		Help: "PVCs without backup configuration per top level controller of the pods using them",
+	}, []string{
+		"namespace",
+		"owner_kind",
+		"owner_name",
+	})
+
+	promProtected := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_protected",
+		Help: "PVCs with backup configuration",
+	}, pvcLabelNames)
+
+	promPVCStatus := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_pvc_status",
+		Help: "State of every evaluated PVC, always 1",
+	}, append(append([]string{}, pvcLabelNames...), "state"))
+
+	promExcludedVolumes := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_excluded_volumes",
+		Help: "Volumes excluded from backups by source",
+	}, append(append([]string{}, nsLabelNames...), "source"))
+
+	promAnnotationChanges := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "backupmonitor_annotation_changes_total",
+		Help: "Observed changes of backup annotations",
+	}, []string{
+		"namespace",
+		"kind",
+	})
+
+	promPermissionMissing := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_permission_missing",
+		Help: "Required permissions missing for the watcher, checked on startup",
+	}, []string{
+		"group",
+		"resource",
+		"namespace",
+		"verb",
+	})
+
+	promUnmanagedPods := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_unmanaged_pods",
+		Help: "Pods with PVCs whose owner kind is not evaluated",
+	}, []string{
+		"namespace",
+		"owner_kind",
+	})
+
+	promUnmounted := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_unmounted",
+		Help: "PVCs with backup configuration that are not mounted by any container",
+	}, pvcLabelNames)
+
+	promAtRisk := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_at_risk",
+		Help: "PVCs that are not missing but whose backup is at risk",
+	}, append(append([]string{}, pvcLabelNames...), "state", "reason"))
+
+	promUnprotectedBytes := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_unprotected_bytes",
+		Help: "Capacity of PVCs without backup configuration",
+	}, []string{
+		"namespace",
+		"storage_class",
+	})
+
+	promUnprotectedSince := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_unprotected_since_timestamp_seconds",
+		Help: "Unix time a PVC without backup configuration became unprotected, derived from the PVC, its pods and observed annotation changes",
+	}, pvcLabelNames)
+
+	promNotOnboarded := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_namespace_not_onboarded",
+		Help: "New namespaces with PVCs but no protected PVC or no covering schedule after the grace period",
+	}, []string{
+		"namespace",
+		"reason",
+	})
+
+	promBackupHooks := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_backup_hooks_unprotected",
+		Help: "Pods with velero backup hooks that mount PVCs without backup configuration, the value is the number of these PVCs",
+	}, []string{
+		"namespace",
+		"pod_name",
+		"hooks",
+	})
+
+	promTenantPVCs := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_tenant_pvcs",
+		Help: "PVCs per tenant and state",
+	}, []string{
+		"tenant",
+		"storage_location",
+		"state",
+	})
+
+	promTenantCoverage := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_tenant_coverage_ratio",
+		Help: "Share of the PVCs of a tenant that are not missing a backup configuration",
+	}, []string{
+		"tenant",
+		"storage_location",
+	})
+
+	promUnprotectedCost := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_unprotected_monthly_cost",
+		Help: "Estimated monthly storage cost of PVCs without backup configuration",
+	}, []string{
+		"namespace",
+		"storage_class",
+	})
+
+	promInformerObjects := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_informer_cached_objects",
+		Help: "Objects in the cache of an informer",
+	}, []string{
+		"informer",
+	})
+	promInformerLastSync := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_informer_last_sync_timestamp_seconds",
+		Help: "Unix time an informer last delivered an event or resync",
+	}, []string{
+		"informer",
+	})
+
+	promAPIServerReachable := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "backupmonitor_apiserver_reachable",
+		Help: "Whether the last probe of the apiserver /version endpoint succeeded",
+	})
+	promRequestDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "backupmonitor_apiserver_request_duration_seconds",
+		Help:    "Latency of the requests of the watcher to the apiserver",
+		Buckets: prometheus.DefBuckets,
+	}, []string{
+		"verb",
+	})
+
+	promUp := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backupmonitor_up",
+		Help: "Health of the subsystems of the watcher",
+	}, []string{
+		"component",
+	})
+
+	promReadOnly := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "backupmonitor_read_only_mode",
+		Help: "1 if the watcher runs in read-only mode and holds no write permissions",
+	})
+	promReadOnly.Set(boolValue(config.ReadOnly))
+
+	promWarmingUp := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "backupmonitor_warming_up",
+		Help: "1 while the informer caches run their initial sync",
+	})
+
+	w := &Watcher{
+		config:                 config,
+		factory:                factory,
+		podInformer:            podInformer,
+		pvcInformer:            pvcInformer,
+		nsInformer:             nsInformer,
+		stsInformer:            stsInformer,
+		rsInformer:             rsInformer,
+		deployInformer:         deployInformer,
+		promMissingBackups:     promMissingBackups,
+		promOwnerMissing:       promOwnerMissing,
+		promProtected:          promProtected,
+		promPVCStatus:          promPVCStatus,
+		promExcludedVolumes:    promExcludedVolumes,
+		promAnnotationChanges:  promAnnotationChanges,
+		promPermissionMissing:  promPermissionMissing,
+		promUnmanagedPods:      promUnmanagedPods,
+		promUnmounted:          promUnmounted,
+		promAtRisk:             promAtRisk,
+		promUnprotectedBytes:   promUnprotectedBytes,
+		promUnprotectedCost:    promUnprotectedCost,
+		promUnprotectedSince:   promUnprotectedSince,
+		promNotOnboarded:       promNotOnboarded,
+		promBackupHooks:        promBackupHooks,
+		promTenantPVCs:         promTenantPVCs,
+		promTenantCoverage:     promTenantCoverage,
+		promInformerObjects:    promInformerObjects,
+		promInformerLastSync:   promInformerLastSync,
+		informerActivity:       map[string]time.Time{},
+		promAPIServerReachable: promAPIServerReachable,
+		promRequestDuration:    promRequestDuration,
+		promUp:                 promUp,
+		promReadOnly:           promReadOnly,
+		promWarmingUp:          promWarmingUp,
+		health:                 map[string]bool{},
+		changes:                NewChangeLog(ChangeLogSize),
+		history:                NewHistory(HistorySize),
+		lastStates:             map[PVCInfo]string{},
+		annotationChanged:      map[PVCInfo]time.Time{},
+		onboardingLogged:       map[string]bool{},
+	}
+	if config.InspectCronJobs {
+		w.cronJobInformer = factory.Batch().V1().CronJobs()
+	}
+	if config.VirtualNodes {
+		w.nodeInformer = factory.Core().V1().Nodes()
+	}
+	w.registerEventHandlers()
+	return w
+}
+
+// Run starts the informers of the factory and waits for the initial cache
+// to sync, informers the embedder already started with factory.Start are
+// not started again
+func (w *Watcher) Run(stopper chan struct{}) {
+	// listed before the custom resource informers run, they are started by
+	// their circuit breakers
+	named := w.namedInformers()
+	for _, informer := range named {
+		w.trackActivity(informer)
+	}
+	w.factory.Start(stopper)
+	w.warmUp(named, stopper)
+	if w.velero != nil {
+		w.velero.runCRDs(stopper, func(informer namedInformer) {
+			w.trackActivity(informer)
+			w.markActivity(informer.name)
+		})
+	}
+}
+
+// namedInformer is an informer with a human readable resource name
+type namedInformer struct {
+	name     string
+	informer cache.SharedIndexInformer
+}
+
+// namedInformers lists all informers the watcher depends on
+func (w *Watcher) namedInformers() []namedInformer {
+	named := []namedInformer{
+		{"pods", w.podInformer.Informer()},
+		{"pvcs", w.pvcInformer.Informer()},
+		{"namespaces", w.nsInformer.Informer()},
+		{"statefulsets", w.stsInformer.Informer()},
+		{"replicasets", w.rsInformer.Informer()},
+		{"deployments", w.deployInformer.Informer()},
+	}
+	if w.cronJobInformer != nil {
+		named = append(named, namedInformer{"cronjobs", w.cronJobInformer.Informer()})
+	}
+	if w.nodeInformer != nil {
+		named = append(named, namedInformer{"nodes", w.nodeInformer.Informer()})
+	}
+	if w.velero != nil {
+		named = append(named, w.velero.namedInformers()...)
+	}
+	return named
+}
+
+// SyncStatus reports for each informer if its cache has synced
+func (w *Watcher) SyncStatus() map[string]bool {
+	status := map[string]bool{}
+	for _, informer := range w.namedInformers() {
+		status[informer.name] = informer.informer.HasSynced()
+	}
+	return status
+}
+
+// Update verifies that all PVCs have a backup configured in a namespace
+func (w *Watcher) Update(namespace string) []PVCInfo {
+	missing := []PVCInfo{}
+	for _, status := range w.Evaluate(namespace) {
+		if status.State == StateMissing {
+			missing = append(missing, status.PVCInfo)
+		}
+	}
+	return missing
+}
+
+// Evaluate classifies all PVCs in a namespace as protected, excluded or missing
+func (w *Watcher) Evaluate(namespace string) []PVCStatus {
+	statuses, _ := w.evaluate(namespace)
+	return statuses
+}
+
+// evaluate classifies all PVCs in a namespace and returns the names of the
+// pods that were looked at
+func (w *Watcher) evaluate(namespace string) ([]PVCStatus, []string) {
+	statuses := []PVCStatus{}
+	pvcList, err := w.pvcInformer.Lister().PersistentVolumeClaims(namespace).List(labels.Everything())
+	if err != nil {
+		log.Printf("unable to list persistent volume claims: %s", err)
+		return nil, nil
+	}
+	handledPVCs := map[string]interface{}{}
+	pods, err := w.getHandledPVCs(namespace, pvcList, &handledPVCs)
+	if err != nil {
+		log.Printf("unable to list pods: %s", err)
+		return nil, nil
+	}
+	// pods of a deleted namespace are removed before its PVCs, checking after
+	// listing both avoids reporting the PVCs as missing in between
+	if w.isTerminatingNamespace(namespace) {
+		return statuses, nil
+	}
+	csiEnabled, drivers := false, map[string]struct{}{}
+	if w.velero != nil && w.config.Features.Enabled(FeatureCSIVerification) {
+		csiEnabled, drivers = w.velero.csiEnabled(), w.velero.snapshotDrivers()
+	}
+	inputs := []map[string]interface{}{}
+	for _, pvc := range pvcList {
+		status := PVCStatus{
+			PVCInfo: PVCInfo{
+				Namespace: namespace,
+				PVCName:   pvc.GetName(),
+			},
+			State:  StateMissing,
+			Method: MethodFsBackup,
+			Labels: pvc.GetLabels(),
+			Size:   pvcSize(pvc),
+		}
+		if pvc.Spec.StorageClassName != nil {
+			status.StorageClass = *pvc.Spec.StorageClassName
+		}
+		if pod := w.firstPod(pvc); pod != nil {
+			kind, name := w.topOwner(pod)
+			status.Owner = kind + "/" + name
+			status.Volume = claimVolume(pod, pvc.GetName())
+		}
+		status.Reason = "no pod lists the volume in " + BackupAnnotation
+		annotations := pvc.GetAnnotations()
+		if v, ok := annotations[ExcludePVCAnnotation]; ok && v == "true" {
+			status.State = StateExcluded
+			status.Reason = "pvc is annotated with " + ExcludePVCAnnotation
+			status.Exclusion = ExclusionPVCAnnotation
+		} else if hasMarker(pvc, w.config.PVCExcluded) {
+			status.State = StateExcluded
+			status.Reason = "pvc matches --pvc-excluded"
+		} else if hasMarker(pvc, w.config.PVCProtected) {
+			status.State = StateProtected
+			status.Reason = "pvc matches --pvc-protected"
+		} else if h, ok := handledPVCs[status.PVCName]; ok {
+			status.State = h.(handling).State
+			status.Reason = h.(handling).Reason
+			status.MissingReason = h.(handling).MissingReason
+			status.Exclusion = h.(handling).Exclusion
+			if status.State == StateProtected && isBlockMode(pvc) {
+				status.State = StateMissing
+				status.MissingReason = ReasonBlockMode
+				status.Reason += ", but fs-backup can not back up volumes in mode Block"
+			}
+			// csi snapshots protect volumes fs-backup can not handle
+			csiFallback := status.MissingReason == ReasonBlockMode ||
+				status.MissingReason == ReasonNoNodeAgent && w.config.VirtualNodesCSI
+			if csiFallback && w.velero != nil {
+				method, protected := w.velero.resolveMethod(pvc, csiEnabled, drivers)
+				status.Method = method
+				if protected {
+					status.State = StateProtected
+					status.MissingReason = ""
+					status.Reason = "csi snapshot of storage class " + status.StorageClass + ", fs-backup is not possible"
+				}
+			}
+		} else if w.velero != nil {
+			method, protected := w.velero.resolveMethod(pvc, csiEnabled, drivers)
+			status.Method = method
+			if protected {
+				status.State = StateProtected
+				status.Reason = "csi snapshot of storage class " + status.StorageClass
+			} else if method == MethodCSI {
+				status.Reason = "storage class supports csi snapshots, but velero has csi support disabled"
+			} else if provisioner, ok := w.velero.provisioner(pvc); ok && len(w.config.SnapshotProvisioners) > 0 {
+				if _, supported := w.config.SnapshotProvisioners[provisioner]; !supported {
+					status.MissingReason = ReasonNoSnapshotSupport
+					status.Reason = "provisioner " + provisioner + " has no snapshot support in the installed velero plugins and no pod lists the volume in " + BackupAnnotation
+				}
+			}
+		}
+		if status.State == StateExcluded {
+			if h, ok := handledPVCs[status.PVCName]; ok && h.(handling).State == StateProtected {
+				status.MissingReason = ReasonExcludedConflict
+				status.Reason += ", but " + h.(handling).Reason
+			}
+		}
+		if status.State == StateMissing && w.config.ExcludeDataSources {
+			if source, ok := dataSource(pvc); ok {
+				status.State = StateExcluded
+				status.MissingReason = ""
+				status.Reason = "pvc is provisioned from " + source
+			}
+		}
+		if len(w.config.Rules) > 0 {
+			w.applyRules(&status, w.ruleVars(status, pvc))
+		}
+		if w.opa != nil {
+			inputs = append(inputs, w.ruleVars(status, pvc))
+		}
+		statuses = append(statuses, status)
+	}
+	if w.opa != nil {
+		w.opa.apply(namespace, statuses, inputs)
+	}
+	scheduled := w.velero == nil || w.velero.scheduled(namespace)
+	if w.velero != nil && w.config.StaleBackupAge > 0 {
+		w.markStaleBackups(namespace, statuses)
+	}
+	for i, pvc := range pvcList {
+		if statuses[i].State == StateUnmounted {
+			statuses[i].MissingReason = ReasonUnmounted
+		}
+		if statuses[i].State != StateMissing {
+			continue
+		}
+		statuses[i].UnprotectedSince = w.unprotectedSince(pvc)
+		if statuses[i].MissingReason != "" {
+			continue
+		}
+		statuses[i].MissingReason = ReasonNoAnnotation
+		if !scheduled {
+			statuses[i].MissingReason = ReasonNoSchedule
+		}
+	}
+	return statuses, pods
+}
+
+// EvaluateAll classifies the PVCs of all namespaces and records state
+// changes, a full evaluation younger than Config.EvaluationCache is reused
+// and concurrent callers share a running evaluation
+func (w *Watcher) EvaluateAll() []PVCStatus {
+	w.evaluationMu.Lock()
+	if w.config.EvaluationCache > 0 && time.Since(w.lastEvaluation) < w.config.EvaluationCache {
+		statuses := append([]PVCStatus{}, w.lastStatuses...)
+		w.evaluationMu.Unlock()
+		return statuses
+	}
+	if call := w.evaluation; call != nil {
+		w.evaluationMu.Unlock()
+		<-call.done
+		return append([]PVCStatus{}, call.statuses...)
+	}
+	call := &evaluationCall{done: make(chan struct{})}
+	w.evaluation = call
+	w.evaluationMu.Unlock()
+
+	generation := w.forgetGeneration()
+	call.statuses = w.evaluateAll(generation)
+	w.evaluationMu.Lock()
+	w.evaluation = nil
+	// a PVC forgotten after recordChanges would be cached again
+	if w.config.EvaluationCache > 0 && w.forgetGeneration() == generation {
+		w.lastEvaluation = time.Now()
+		w.lastStatuses = call.statuses
+	}
+	w.evaluationMu.Unlock()
+	close(call.done)
+	return call.statuses
+}
+
+// evaluateAll runs a full evaluation, generation is the forget generation at
+// its start
+func (w *Watcher) evaluateAll(generation uint64) []PVCStatus {
+	namespaces := []string{}
+	nsList, _ := w.ListNamespaces()
+	for _, namespace := range nsList {
+		if w.isExcludedNamespace(namespace.GetName()) || isTerminating(namespace) {
+			continue
+		}
+		namespaces = append(namespaces, namespace.GetName())
+	}
+
+	// evaluate the namespaces with a bounded number of workers, results are
+	// kept in namespace order
+	workers := w.config.EvaluationWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([][]PVCStatus, len(namespaces))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = w.Evaluate(namespaces[index])
+			}
+		}()
+	}
+	for index := range namespaces {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	// evaluate returns nil if the caches could not be listed
+	statuses := []PVCStatus{}
+	healthy := true
+	for _, result := range results {
+		if result == nil {
+			healthy = false
+		}
+		statuses = append(statuses, result...)
+	}
+	w.setHealth(ComponentEvaluator, healthy)
+	statuses = w.recordChanges(statuses, generation)
+	w.history.Record(Summarize(time.Now(), statuses))
+	w.markReady()
+	for _, listener := range w.listeners {
+		listener(statuses)
+	}
+	return statuses
+}
+
+// OnEvaluation registers a listener called with the statuses of every full
+// evaluation, it has to be called before Run
+func (w *Watcher) OnEvaluation(listener func([]PVCStatus)) {
+	w.listeners = append(w.listeners, listener)
+}
+
+// OnEvaluationAsync registers a listener that runs in its own goroutine, so
+// listeners writing to the cluster do not block the evaluation and with it
+// the scrape. Evaluations finished while the listener is busy are coalesced,
+// it is called with the statuses of the latest one.
+func (w *Watcher) OnEvaluationAsync(listener func([]PVCStatus)) {
+	pending := make(chan []PVCStatus, 1)
+	go func() {
+		for statuses := range pending {
+			listener(statuses)
+		}
+	}()
+	w.OnEvaluation(func(statuses []PVCStatus) {
+		// replace statuses the listener did not pick up yet
+		select {
+		case <-pending:
+		default:
+		}
+		pending <- statuses
+	})
+}
+
+// recordChanges compares the statuses with the previous evaluation, stores
+// all transitions in the change log and logs them. The first evaluation is
+// the baseline, it is logged as a summary and records no changes, so a
+// restart does not push the real changes out of the change log. If forget
+// ran since the evaluation started, the statuses of PVCs no longer in the
+// cache are dropped, they were forgotten already and are not recorded again.
+func (w *Watcher) recordChanges(statuses []PVCStatus, generation uint64) []PVCStatus {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+
+	if w.forgotten != generation {
+		existing := make([]PVCStatus, 0, len(statuses))
+		for _, status := range statuses {
+			if _, err := w.pvcInformer.Lister().PersistentVolumeClaims(status.Namespace).Get(status.PVCName); err == nil {
+				existing = append(existing, status)
+			}
+		}
+		statuses = existing
+	}
+
+	now := time.Now()
+	current := make(map[PVCInfo]string, len(statuses))
+	for _, status := range statuses {
+		current[status.PVCInfo] = status.State
+		if previous := w.lastStates[status.PVCInfo]; w.recorded && previous != status.State {
+			change := Change{
+				Time:      now,
+				Namespace: status.Namespace,
+				PVCName:   status.PVCName,
+				From:      previous,
+				To:        status.State,
+			}
+			w.changes.Add(change)
+			logChange(change, status.Reason)
+		}
+	}
+	for info, previous := range w.lastStates {
+		if _, ok := current[info]; !ok {
+			change := Change{
+				Time:      now,
+				Namespace: info.Namespace,
+				PVCName:   info.PVCName,
+				From:      previous,
+			}
+			w.changes.Add(change)
+			logChange(change, "pvc was deleted")
+		}
+	}
+	if !w.recorded {
+		summary := Summarize(now, statuses)
+		log.Printf("initial evaluation total=%d protected=%d excluded=%d missing=%d", summary.Total,
+			summary.States[StateProtected], summary.States[StateExcluded], summary.States[StateMissing])
+	}
+	w.lastStates = current
+	w.recorded = true
+	return statuses
+}
+
+// forgetGeneration returns the number of forget calls so far
+func (w *Watcher) forgetGeneration() uint64 {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	return w.forgotten
+}
+
+func (w *Watcher) ListNamespaces() ([]*v1.Namespace, error) {
+	return w.nsInformer.Lister().List(labels.Everything())
+}
+
+// isExcludedNamespace checks if a namespace is excluded from evaluation
+func (w *Watcher) isExcludedNamespace(namespace string) bool {
+	return w.config.ExcludeNamespaces != nil && w.config.ExcludeNamespaces.MatchString(namespace)
+}
+
+// isTerminatingNamespace checks if a namespace is being deleted or is gone
+func (w *Watcher) isTerminatingNamespace(namespace string) bool {
+	ns, err := w.nsInformer.Lister().Get(namespace)
+	if apierrors.IsNotFound(err) {
+		return true
+	}
+	return err == nil && isTerminating(ns)
+}
+
+// isTerminating checks if the namespace is being deleted
+func isTerminating(ns *v1.Namespace) bool {
+	return ns.GetDeletionTimestamp() != nil || ns.Status.Phase == v1.NamespaceTerminating
+}
+
+// getHandledPVCs lists all PVCs that have a backup handling defined on a pod,
+// only the pods referencing one of the PVCs are looked at. It returns the
+// names of the evaluated pods.
+func (w *Watcher) getHandledPVCs(namespace string, pvcList []*v1.PersistentVolumeClaim, pvcNames *map[string]interface{}) ([]string, error) {
+	podList, err := w.podsForPVCs(namespace, pvcList)
+	if err != nil {
+		return nil, err
+	}
+	evaluated := []string{}
+	if w.cronJobInformer != nil {
+		podList = append(podList, w.cronJobPods(namespace)...)
+	}
+	podList = w.latestRevisionPods(podList)
+	sort.Slice(podList, func(i, j int) bool {
+		return podList[i].GetName() < podList[j].GetName()
+	})
+	optOut := w.velero != nil && w.velero.defaultsToFsBackup(namespace)
+	knownParents := map[string]struct{}{}
+pods:
+	for _, pod := range podList {
+		owners := pod.GetOwnerReferences()
+		for _, owner := range owners {
+			if _, ok := knownParents[string(owner.UID)]; ok && owner.Kind != "StatefulSet" {
+				continue pods
+			}
+			knownParents[string(owner.UID)] = struct{}{}
+		}
+		evaluated = append(evaluated, pod.GetName())
+		if !w.isManaged(pod) {
+			markPodPVCs(pod, StateUnmanaged, "owner kind "+w.topOwnerKind(pod)+" is not in --owner-kinds", pvcNames)
+			continue
+		}
+		if w.isExcludedFromBackup(pod) {
+			markPodPVCs(pod, StateExcluded, "or its controller is labeled "+ExcludeFromBackupLabel, pvcNames)
+			continue
+		}
+		if w.config.ExcludePods != nil && w.config.ExcludePods.Matches(labels.Set(pod.GetLabels())) {
+			markPodPVCs(pod, StateExcluded, "matches --exclude-pods-selector", pvcNames)
+			continue
+		}
+		if node, ok := w.virtualNode(pod); ok {
+			listVirtualPodHandledPVCs(pod, node, optOut, w.config.RequireMounted, w.config.InitOnlyExcluded, pvcNames)
+			continue
+		}
+		listPodHandledPVCs(pod, optOut, w.config.RequireMounted, w.config.InitOnlyExcluded, pvcNames)
+
+	}
+	return evaluated, nil
+}
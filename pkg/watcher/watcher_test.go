@@ -0,0 +1,247 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestWatcher creates a watcher whose informers are not started, the
+// objects are added to the caches directly
+func newTestWatcher(t *testing.T, config Config, objects ...interface{}) *Watcher {
+	w := NewWatcher(informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0), config)
+	for _, obj := range objects {
+		var err error
+		switch o := obj.(type) {
+		case *v1.Namespace:
+			err = w.nsInformer.Informer().GetIndexer().Add(o)
+		case *v1.PersistentVolumeClaim:
+			err = w.pvcInformer.Informer().GetIndexer().Add(o)
+		case *v1.Pod:
+			err = w.podInformer.Informer().GetIndexer().Add(o)
+		default:
+			t.Fatalf("unsupported object %T", obj)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w
+}
+
+func testNamespace(name string, deleting bool, phase v1.NamespacePhase) *v1.Namespace {
+	ns := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     v1.NamespaceStatus{Phase: phase},
+	}
+	if deleting {
+		now := metav1.Now()
+		ns.DeletionTimestamp = &now
+	}
+	return ns
+}
+
+func testPVC(namespace, name string) *v1.PersistentVolumeClaim {
+	return &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
+
+// testPod creates a pod mounting the PVCs as volumes named like the PVCs,
+// annotations are the pod annotations
+func testPod(namespace, name string, annotations map[string]string, pvcs ...string) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Annotations: annotations},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+	}
+	for _, pvc := range pvcs {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+			Name: pvc,
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: pvc},
+			},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, v1.VolumeMount{Name: pvc})
+	}
+	return pod
+}
+
+func TestEvaluateNamespaceDeletion(t *testing.T) {
+	backup := map[string]string{BackupAnnotation: "data"}
+	tests := []struct {
+		name      string
+		namespace *v1.Namespace
+		pods      []*v1.Pod
+		states    []string
+	}{
+		{
+			name:      "active namespace",
+			namespace: testNamespace("shop", false, v1.NamespaceActive),
+			pods:      []*v1.Pod{testPod("shop", "db-0", backup, "data")},
+			states:    []string{StateProtected},
+		},
+		{
+			name:      "active namespace without pods",
+			namespace: testNamespace("shop", false, v1.NamespaceActive),
+			states:    []string{StateMissing},
+		},
+		{
+			name:      "deletion timestamp set, pods still cached",
+			namespace: testNamespace("shop", true, v1.NamespaceActive),
+			pods:      []*v1.Pod{testPod("shop", "db-0", backup, "data")},
+		},
+		{
+			name:      "terminating, pods already removed",
+			namespace: testNamespace("shop", true, v1.NamespaceTerminating),
+		},
+		{
+			name:      "terminating phase without deletion timestamp",
+			namespace: testNamespace("shop", false, v1.NamespaceTerminating),
+		},
+		{
+			// the namespace and its pods are gone from the caches between
+			// listing the PVCs and the pods, the PVCs are not yet removed
+			name: "deleted between the PVC and pod listings",
+		},
+	}
+	for _, test := range tests {
+		objects := []interface{}{testPVC("shop", "data")}
+		if test.namespace != nil {
+			objects = append(objects, test.namespace)
+		}
+		for _, pod := range test.pods {
+			objects = append(objects, pod)
+		}
+		w := newTestWatcher(t, Config{}, objects...)
+
+		for evaluation, statuses := range map[string][]PVCStatus{
+			"Evaluate":    w.Evaluate("shop"),
+			"EvaluateAll": w.EvaluateAll(),
+		} {
+			if len(statuses) != len(test.states) {
+				t.Errorf("%s: %s returned %d PVCs, expected %d", test.name, evaluation, len(statuses), len(test.states))
+				continue
+			}
+			for i, status := range statuses {
+				if status.State != test.states[i] {
+					t.Errorf("%s: %s classified %s as %s, expected %s", test.name, evaluation, status.PVCName, status.State, test.states[i])
+				}
+			}
+		}
+	}
+}
+
+func TestEvaluateEphemeralVolumes(t *testing.T) {
+	ephemeralPod := func(annotations map[string]string) *v1.Pod {
+		pod := testPod("shop", "worker-0", annotations)
+		pod.Spec.Volumes = []v1.Volume{{
+			Name:         "scratch",
+			VolumeSource: v1.VolumeSource{Ephemeral: &v1.EphemeralVolumeSource{}},
+		}}
+		pod.Spec.Containers[0].VolumeMounts = []v1.VolumeMount{{Name: "scratch"}}
+		return pod
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		state       string
+	}{
+		{"listed for backup", map[string]string{BackupAnnotation: "scratch"}, StateProtected},
+		{"excluded", map[string]string{ExcludeAnnotation: "scratch"}, StateExcluded},
+		{"without annotation", nil, StateMissing},
+	}
+	for _, test := range tests {
+		w := newTestWatcher(t, Config{},
+			testNamespace("shop", false, v1.NamespaceActive),
+			testPVC("shop", "worker-0-scratch"),
+			ephemeralPod(test.annotations),
+		)
+		statuses := w.Evaluate("shop")
+		if len(statuses) != 1 {
+			t.Fatalf("%s: got %d PVCs, expected 1", test.name, len(statuses))
+		}
+		if statuses[0].State != test.state || statuses[0].Volume != "scratch" {
+			t.Errorf("%s: got %s of volume %q, expected %s of volume scratch", test.name, statuses[0].State, statuses[0].Volume, test.state)
+		}
+	}
+}
+
+func TestExcludedVolumesSource(t *testing.T) {
+	excludedPVC := testPVC("shop", "cache")
+	excludedPVC.Annotations = map[string]string{ExcludePVCAnnotation: "true"}
+	w := newTestWatcher(t, Config{PVCExcluded: map[string]string{"tier": "scratch"}},
+		testNamespace("shop", false, v1.NamespaceActive),
+		testNamespace("billing", false, v1.NamespaceActive),
+		testPVC("shop", "data"),
+		testPVC("shop", "logs"),
+		excludedPVC,
+		testPod("shop", "db-0", map[string]string{ExcludeAnnotation: "data,logs"}, "data", "logs"),
+		testPVC("billing", "ledger"),
+		testPod("billing", "ledger-0", map[string]string{BackupAnnotation: "ledger"}, "ledger"),
+	)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(w)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]float64{
+		"shop/pod_annotation":    2,
+		"shop/pvc_annotation":    1,
+		"shop/config":            0,
+		"billing/pod_annotation": 0,
+		"billing/pvc_annotation": 0,
+		"billing/config":         0,
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "backupmonitor_excluded_volumes" {
+			continue
+		}
+		for _, metric := range family.Metric {
+			labels := map[string]string{}
+			for _, pair := range metric.Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			values[labels["namespace"]+"/"+labels["source"]] = metric.GetGauge().GetValue()
+		}
+	}
+	if len(values) != len(expected) {
+		t.Errorf("got series %v, expected %v", values, expected)
+	}
+	for series, value := range expected {
+		if got, ok := values[series]; !ok || got != value {
+			t.Errorf("%s is %g, expected %g", series, got, value)
+		}
+	}
+}
+
+func TestRecordChangesAfterForget(t *testing.T) {
+	data := testPVC("shop", "data")
+	w := newTestWatcher(t, Config{},
+		testNamespace("shop", false, v1.NamespaceActive),
+		data,
+		testPVC("shop", "logs"),
+	)
+	w.recordChanges(w.Evaluate("shop"), w.forgetGeneration())
+
+	// the PVC is deleted while an evaluation that listed it is running
+	generation := w.forgetGeneration()
+	statuses := w.Evaluate("shop")
+	if err := w.pvcInformer.Informer().GetIndexer().Delete(data); err != nil {
+		t.Fatal(err)
+	}
+	w.forget(func(info PVCInfo) bool {
+		return info.Namespace == "shop" && info.PVCName == "data"
+	})
+	statuses = w.recordChanges(statuses, generation)
+
+	if len(statuses) != 1 || statuses[0].PVCName != "logs" {
+		t.Errorf("got %d statuses, expected only logs: %v", len(statuses), statuses)
+	}
+	if _, ok := w.lastStates[PVCInfo{Namespace: "shop", PVCName: "data"}]; ok {
+		t.Error("the forgotten PVC was recorded again")
+	}
+}